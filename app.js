@@ -476,8 +476,13 @@ async function analyze() {
             result = await callBackendMock(currentPatientData);
         }
 
-        if (activeModel !== 'mock') {
-            result = mergeWithRules(result, currentPatientData);
+        if (result?.fallback?.attempts?.length) {
+            const tried = result.fallback.attempts.map(a => `${a.provider.toUpperCase()} (${a.reason})`).join(', ');
+            await addLog(`FALLBACK: ${tried} -> ${(result.model || result.source || 'rules').toUpperCase()}`);
+        }
+
+        if (result?.assessmentId) {
+            await addLog(`ASSESSMENT RECORDED: ${result.assessmentId}`);
         }
 
         await addLog("VALIDATING JSON SCHEMA...");
@@ -526,6 +531,14 @@ async function analyze() {
 }
 
 // API FUNCTIONS
+// Bearer credential (API key or OIDC access token) for servers with authentication enabled.
+function apiHeaders() {
+    const headers = { 'Content-Type': 'application/json' };
+    const token = APP_CONFIG.authToken || sessionStorage.getItem('gorocky.authToken');
+    if (token) headers.Authorization = `Bearer ${token}`;
+    return headers;
+}
+
 async function parseJsonStrict(response, label) {
     const raw = await response.text();
     if (!raw?.trim()) {
@@ -541,7 +554,7 @@ async function parseJsonStrict(response, label) {
 async function callBackendMock(patientData) {
     const response = await fetch(`${API_BASE}/api/diagnostics/mock`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: apiHeaders(),
         body: JSON.stringify(patientData)
     });
     if (!response.ok) {
@@ -563,9 +576,9 @@ async function callBackendMock(patientData) {
 }
 
 async function callGemini(patientData) {
-    const response = await fetch(`${API_BASE}/api/diagnostics/gemini`, {
+    const response = await fetch(`${API_BASE}/api/diagnostics/hybrid?model=gemini`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: apiHeaders(),
         body: JSON.stringify(patientData)
     });
     if (!response.ok) {
@@ -576,9 +589,9 @@ async function callGemini(patientData) {
 }
 
 async function callOpenAI(patientData) {
-    const response = await fetch(`${API_BASE}/api/diagnostics/openai`, {
+    const response = await fetch(`${API_BASE}/api/diagnostics/hybrid?model=openai`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: apiHeaders(),
         body: JSON.stringify(patientData)
     });
     if (!response.ok) {
@@ -599,7 +612,7 @@ async function fetchInteractionChecks(patientData) {
     };
     const response = await fetch(`${API_BASE}/api/interactions/check`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: apiHeaders(),
         body: JSON.stringify(payload)
     });
     if (!response.ok) {
@@ -909,32 +922,6 @@ function runSafetyEngine(data) {
     };
 }
 
-function mergeWithRules(modelResult, patientData) {
-    const rules = runSafetyEngine(patientData);
-    const merged = { ...rules, ...modelResult };
-
-    merged.interactions = rules.interactions;
-    merged.contraindications = rules.contraindications;
-    merged.dosingConcerns = rules.dosingConcerns;
-    merged.issues = Array.from(new Set([...(modelResult.issues || []), ...(rules.issues || [])]));
-
-    const level = higherRiskLevel(modelResult.riskLevel, rules.riskLevel);
-    merged.riskLevel = level;
-    merged.riskScore = Math.max(modelResult.riskScore || 0, rules.riskScore || 0);
-
-    merged.plan = modelResult.plan || rules.plan;
-    merged.alternatives = modelResult.alternatives || rules.alternatives;
-    merged.confidenceScore = modelResult.confidenceScore ?? rules.confidenceScore;
-    merged.source = modelResult.source ? `${modelResult.source}+rules` : "rules+model";
-
-    return merged;
-}
-
-function higherRiskLevel(a, b) {
-    const rank = { "LOW": 0, "MEDIUM": 1, "HIGH": 2 };
-    return (rank[a] || 0) >= (rank[b] || 0) ? a : b;
-}
-
 function mockAnalyze(data) {
     return runSafetyEngine(data);
 }
@@ -1040,18 +1027,26 @@ function renderResults(data) {
             target.innerHTML = `<li class="issue-item" style="border-color:var(--status-success);"><div class="issue-icon" style="background:var(--status-success); color:white;">✓</div><span>${emptyText}</span></li>`;
             return;
         }
+        // Which rule fired and on which inputs ("nitrates+pde5i · imdur 30mg → nitrates"). Inputs are
+        // patient-entered text, so they are escaped.
+        const escapeHTML = (text) => String(text).replace(/[&<>"']/g, ch => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[ch]));
+        const why = (item) => {
+            if (!item.ruleId) return '';
+            const inputs = (item.matchedOn || []).map(m => `${m.input} → ${m.criterion.replace(/^[^:]*:\s*/, '')}`);
+            return `<div style="font-size:0.72rem; opacity:0.7; margin-top:2px;">${escapeHTML([item.ruleId, ...inputs].join(' · '))}</div>`;
+        };
         target.innerHTML = items.map(item => {
             const sev = item.severity || 'LOW';
             const sevColor = sev === 'HIGH' ? 'var(--status-error)' : sev === 'MEDIUM' ? 'var(--status-warning)' : 'var(--status-success)';
             const badge = `<span style="display:inline-block; padding:2px 6px; border-radius:6px; background:${sevColor}; color:white; font-size:0.7rem; margin-right:6px;">${sev}</span>`;
             if (item.pair) {
-                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.pair} — ${item.note}</span></li>`;
+                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.pair} — ${item.note}${why(item)}</span></li>`;
             }
             if (item.conditionOrAllergy) {
-                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.conditionOrAllergy} — ${item.note}</span></li>`;
+                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.conditionOrAllergy} — ${item.note}${why(item)}</span></li>`;
             }
             if (item.factor) {
-                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.factor} — ${item.recommendation}</span></li>`;
+                return `<li class="issue-item"><div class="issue-icon" style="background:${sevColor}; color:white;">!</div><span>${badge}${item.factor} — ${item.recommendation}${why(item)}</span></li>`;
             }
             return `<li class="issue-item"><div class="issue-icon" style="background:var(--status-warning); color:white;">!</div><span>${JSON.stringify(item)}</span></li>`;
         }).join('');
@@ -1134,7 +1129,26 @@ function backToResults() {
     document.getElementById('step-results').style.display = 'block';
 }
 
-function finalizeReview() {
+async function submitReview(review) {
+    const response = await fetch(`${API_BASE}/api/assessments/${encodeURIComponent(reviewedPlan.assessmentId)}/review`, {
+        method: 'POST',
+        headers: apiHeaders(),
+        body: JSON.stringify(review)
+    });
+    if (response.status === 422) {
+        const json = await parseJsonStrict(response, 'Review API');
+        const err = new Error('Validation failed');
+        err.name = 'ValidationError';
+        err.issues = json.issues || [];
+        throw err;
+    }
+    if (!response.ok) {
+        throw new Error(`Review API error (${response.status}): ${await response.text()}`);
+    }
+    return await parseJsonStrict(response, 'Review API');
+}
+
+async function finalizeReview() {
     const reviewer = document.getElementById('reviewer-name').value || "UNKNOWN_REVIEWER";
     const planMed = document.getElementById('review-med').value || reviewedPlan.plan.medication;
     const planDose = document.getElementById('review-dose').value || reviewedPlan.plan.dosage;
@@ -1154,6 +1168,24 @@ function finalizeReview() {
     reviewedPlan.confidenceScore = Math.min(1, Math.max(0, planConf));
     reviewedPlan.reviewer = reviewer;
 
+    if (reviewedPlan.assessmentId) {
+        try {
+            await submitReview({
+                reviewer,
+                plan: reviewedPlan.plan,
+                confidence: reviewedPlan.confidenceScore,
+                justification: document.getElementById('review-justification').value || ''
+            });
+        } catch (e) {
+            if (e.name === 'ValidationError') {
+                alert(`Review not saved:\n${e.issues.map(i => `- ${i.field}: ${i.message}`).join('\n')}`);
+                return;
+            }
+            console.warn("Review submission failed", e);
+            alert(`Review could not be recorded on the server.\n\nDetails: ${e.message || 'Unknown error'}`);
+        }
+    }
+
     renderResults(reviewedPlan);
     finalizeWithSummary(reviewedPlan);
 }
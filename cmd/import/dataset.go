@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	kindDrug  = "drug"
+	kindClass = "class"
+
+	// classPrefix marks a side that names a drug class rather than a drug ("class:nitrates").
+	classPrefix = "class:"
+)
+
+// record is one drug_interactions row in canonical form: lowercase names with the sides ordered
+// by (kind, name), so class sides come first.
+type record struct {
+	KindA         string   `json:"-"`
+	DrugA         string   `json:"drug_a"`
+	KindB         string   `json:"-"`
+	DrugB         string   `json:"drug_b"`
+	Severity      string   `json:"severity"`
+	Note          string   `json:"note"`
+	Source        string   `json:"source"`
+	EvidenceLevel string   `json:"evidence_level"`
+	References    []string `json:"references"`
+}
+
+func (r record) key() string {
+	return r.KindA + ":" + r.DrugA + "|" + r.KindB + ":" + r.DrugB + "|" + r.Source
+}
+
+// side splits an optional "class:" prefix off a drug_a or drug_b value.
+func side(value string) (kind, name string) {
+	name = strings.ToLower(strings.Join(strings.Fields(value), " "))
+	if rest, ok := strings.CutPrefix(name, classPrefix); ok {
+		return kindClass, strings.TrimSpace(rest)
+	}
+	return kindDrug, name
+}
+
+// label is the inverse of side, used in messages.
+func label(kind, name string) string {
+	if kind == kindClass {
+		return classPrefix + name
+	}
+	return name
+}
+
+var severityAliases = map[string]string{
+	"HIGH":            "HIGH",
+	"MAJOR":           "HIGH",
+	"SEVERE":          "HIGH",
+	"CONTRAINDICATED": "HIGH",
+	"MEDIUM":          "MEDIUM",
+	"MODERATE":        "MEDIUM",
+	"LOW":             "LOW",
+	"MINOR":           "LOW",
+}
+
+// normalize canonicalizes a parsed row. Rows without a source take defaultSource.
+func (r record) normalize(defaultSource string) (record, error) {
+	r.KindA, r.DrugA = side(r.DrugA)
+	r.KindB, r.DrugB = side(r.DrugB)
+	if r.DrugA == "" || r.DrugB == "" {
+		return record{}, errors.New("drug_a and drug_b are required")
+	}
+	if r.KindA == r.KindB && r.DrugA == r.DrugB {
+		return record{}, fmt.Errorf("drug_a and drug_b are both %q", r.DrugA)
+	}
+	if r.KindA > r.KindB || (r.KindA == r.KindB && r.DrugA > r.DrugB) {
+		r.KindA, r.DrugA, r.KindB, r.DrugB = r.KindB, r.DrugB, r.KindA, r.DrugA
+	}
+	severity, ok := severityAliases[strings.ToUpper(strings.TrimSpace(r.Severity))]
+	if !ok {
+		return record{}, fmt.Errorf("unknown severity %q", r.Severity)
+	}
+	r.Severity = severity
+	r.Note = strings.TrimSpace(r.Note)
+	r.Source = strings.TrimSpace(r.Source)
+	if r.Source == "" {
+		r.Source = defaultSource
+	}
+	if r.Source == "" {
+		return record{}, errors.New("source is required (set it per row or with -source)")
+	}
+	r.EvidenceLevel = strings.ToLower(strings.TrimSpace(r.EvidenceLevel))
+	refs := []string{}
+	for _, ref := range r.References {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	r.References = refs
+	return r, nil
+}
+
+// parseCSV reads a dataset with a header row. drug_a, drug_b and severity are required columns;
+// note, source, evidence_level and references (separated by "|") are optional. A drug_a or drug_b
+// of "class:<name>" refers to a drug class from the registry.
+func parseCSV(in io.Reader, defaultSource string) ([]record, error) {
+	reader := csv.NewReader(in)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"drug_a", "drug_b", "severity"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var out []record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec, err := record{
+			DrugA:         field(row, "drug_a"),
+			DrugB:         field(row, "drug_b"),
+			Severity:      field(row, "severity"),
+			Note:          field(row, "note"),
+			Source:        field(row, "source"),
+			EvidenceLevel: field(row, "evidence_level"),
+			References:    strings.Split(field(row, "references"), "|"),
+		}.normalize(defaultSource)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, rec)
+	}
+}
+
+// parseJSON reads a dataset given as an array of objects with the same keys as the CSV columns;
+// references is an array of strings.
+func parseJSON(in io.Reader, defaultSource string) ([]record, error) {
+	var rows []record
+	if err := json.NewDecoder(in).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	out := make([]record, 0, len(rows))
+	for i, row := range rows {
+		rec, err := row.normalize(defaultSource)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// dedupe keeps the last row for each pair and source, preserving first-seen order.
+func dedupe(records []record) []record {
+	index := map[string]int{}
+	var out []record
+	for _, r := range records {
+		if i, ok := index[r.key()]; ok {
+			out[i] = r
+			continue
+		}
+		index[r.key()] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
+
+// checkClasses fails when a "class:" side names a class known does not recognize, listing every
+// unknown class so a typo such as class:nitrate is caught before it imports a row that never matches.
+func checkClasses(records []record, known func(string) bool) error {
+	var unknown []string
+	for _, r := range records {
+		for _, s := range []struct{ kind, name string }{{r.KindA, r.DrugA}, {r.KindB, r.DrugB}} {
+			if s.kind == kindClass && !known(s.name) && !slices.Contains(unknown, label(s.kind, s.name)) {
+				unknown = append(unknown, label(s.kind, s.name))
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown drug classes (not in the drug-class registry): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
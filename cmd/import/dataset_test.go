@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Skufu/GoRocky/internal/drugclasses"
+)
+
+func TestParseCSVNormalizesRows(t *testing.T) {
+	in := "Drug_A,drug_b,severity,note,references\n" +
+		"Sildenafil, Isosorbide  Mononitrate,major,Hypotension,PI §4|  |DOI 10.1/x\n"
+	rows, err := parseCSV(strings.NewReader(in), "lexi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := rows[0]
+	if got.DrugA != "isosorbide mononitrate" || got.DrugB != "sildenafil" || got.Severity != "HIGH" || got.Source != "lexi" {
+		t.Fatalf("row not canonicalized: %+v", got)
+	}
+	if len(got.References) != 2 || got.References[1] != "DOI 10.1/x" {
+		t.Fatalf("unexpected references %q", got.References)
+	}
+}
+
+func TestParseRejectsBadRows(t *testing.T) {
+	for name, in := range map[string]string{
+		"missing column":   "drug_a,drug_b\nx,y\n",
+		"unknown severity": "drug_a,drug_b,severity\nx,y,catastrophic\n",
+		"same drug":        "drug_a,drug_b,severity\nx,X,LOW\n",
+		"no source":        "drug_a,drug_b,severity\nx,y,LOW\n",
+	} {
+		if _, err := parseCSV(strings.NewReader(in), ""); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := parseJSON(strings.NewReader(`[{"drug_a":"x","drug_b":"y","severity":"low"}]`), ""); err == nil {
+		t.Error("expected JSON row without source to be rejected")
+	}
+}
+
+func TestParseJSONAndDedupe(t *testing.T) {
+	rows, err := parseJSON(strings.NewReader(`[
+		{"drug_a":"tadalafil","drug_b":"ritonavir","severity":"moderate","source":"a","references":["PI"]},
+		{"drug_a":"ritonavir","drug_b":"tadalafil","severity":"high","source":"a"},
+		{"drug_a":"ritonavir","drug_b":"tadalafil","severity":"low","source":"b"}
+	]`), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows = dedupe(rows)
+	if len(rows) != 2 || rows[0].Severity != "HIGH" || rows[0].Source != "a" || rows[1].Source != "b" {
+		t.Fatalf("expected last row per pair and source to win, got %+v", rows)
+	}
+}
+
+func TestSeedCoversRulePackClasses(t *testing.T) {
+	rows, err := parseCSV(bytes.NewReader(seedCSV), "gorocky-seed")
+	if err != nil {
+		t.Fatalf("bundled seed does not parse: %v", err)
+	}
+	pairs := map[string]bool{}
+	for _, r := range rows {
+		pairs[r.DrugA+"|"+r.DrugB] = true
+	}
+	// One member pair per class-level interaction in rules/default.yaml.
+	for _, pair := range []string{"nitroglycerin|sildenafil", "tadalafil|tamsulosin", "ketoconazole|vardenafil", "avanafil|ritonavir"} {
+		if !pairs[pair] {
+			t.Errorf("seed missing %s", pair)
+		}
+	}
+	if len(dedupe(rows)) != len(rows) {
+		t.Error("seed contains duplicate pairs")
+	}
+}
+
+func TestParseClassSides(t *testing.T) {
+	rows, err := parseCSV(strings.NewReader("drug_a,drug_b,severity\n"+
+		"Class:PDE5i,class:nitrates,high\n"+
+		"tadalafil,class:cyp3a4inhibitors,moderate\n"+
+		"class:nitrates,nitrates,low\n"), "kb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := []string{}
+	for _, r := range rows {
+		got = append(got, r.KindA+":"+r.DrugA+"|"+r.KindB+":"+r.DrugB)
+	}
+	want := "class:nitrates|class:pde5i,class:cyp3a4inhibitors|drug:tadalafil,class:nitrates|drug:nitrates"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("class sides not canonicalized: %v", got)
+	}
+	if _, err := parseCSV(strings.NewReader("drug_a,drug_b,severity\nclass:pde5i,class:PDE5i,low\n"), "kb"); err == nil {
+		t.Fatal("expected a class paired with itself to be rejected")
+	}
+}
+
+func TestCheckClassesAgainstRegistry(t *testing.T) {
+	registry, err := drugclasses.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := parseCSV(strings.NewReader("drug_a,drug_b,severity\n"+
+		"class:pde5i,class:nitrates,high\n"+
+		"tadalafil,class:cyp3a4inhibitors,moderate\n"), "kb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkClasses(rows, registry.Has); err != nil {
+		t.Fatalf("expected registry classes to pass, got %v", err)
+	}
+
+	typo, _ := parseCSV(strings.NewReader("drug_a,drug_b,severity\nclass:nitrate,sildenafil,high\nclass:nitrate,class:pde5,high\n"), "kb")
+	err = checkClasses(typo, registry.Has)
+	if err == nil || !strings.Contains(err.Error(), "class:nitrate, class:pde5") {
+		t.Fatalf("expected both unknown classes to be reported, got %v", err)
+	}
+	if err := checkClasses(typo[:1], func(name string) bool { return name == "nitrate" }); err != nil {
+		t.Fatalf("classes from the database must be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Command import loads drug-drug interaction datasets into the drug_interactions table
+// (migrations/0006_drug_interactions.sql).
+//
+//	go run ./cmd/import -seed                      # bundled seed set
+//	go run ./cmd/import -source lexi data/*.csv    # CSV or JSON datasets
+//
+// Imports are idempotent: rows are keyed by their two sides and source, so re-running an import
+// updates changed rows and leaves the rest untouched. A side written as "class:nitrates" covers
+// every member of that drug class (migrations/0008_class_interactions.sql); the import fails when a
+// class is neither in the drug-class registry nor in the drug_class_members table.
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Skufu/GoRocky/internal/drugclasses"
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+)
+
+//go:embed seed/drug_interactions.csv
+var seedCSV []byte
+
+type importStats struct {
+	inserted, updated, unchanged int
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	dbURL := flag.String("db", os.Getenv("DATABASE_URL"), "Postgres connection string (default $DATABASE_URL)")
+	format := flag.String("format", "", "dataset format: csv or json (default: from file extension)")
+	source := flag.String("source", "", "source recorded for rows that do not name one")
+	seed := flag.Bool("seed", false, "import the bundled seed set")
+	dryRun := flag.Bool("dry-run", false, "parse and validate without writing to the database")
+	classesPath := flag.String("classes", os.Getenv("DRUG_CLASSES_PATH"), "drug-class registry file for class: sides (default $DRUG_CLASSES_PATH, else the bundled registry)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: import [flags] [dataset.csv|dataset.json ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !*seed && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var records []record
+	if *seed {
+		rows, err := parseCSV(bytes.NewReader(seedCSV), "gorocky-seed")
+		if err != nil {
+			log.Fatalf("bundled seed: %v", err)
+		}
+		records = append(records, rows...)
+	}
+	for _, path := range flag.Args() {
+		rows, err := readDataset(path, *format, *source)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, rows...)
+	}
+	records = dedupe(records)
+
+	classes, err := drugclasses.Load(*classesPath)
+	if err != nil {
+		log.Fatalf("drug class registry: %v", err)
+	}
+	if *dryRun {
+		if err := checkClasses(records, classes.Has); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d interactions validated\n", len(records))
+		return
+	}
+	if *dbURL == "" {
+		log.Fatal("DATABASE_URL (or -db) is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, *dbURL)
+	if err != nil {
+		log.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	dbClasses, err := classNamesFromDB(ctx, conn)
+	if err != nil {
+		log.Fatalf("drug class members: %v", err)
+	}
+	if err := checkClasses(records, func(name string) bool { return classes.Has(name) || dbClasses[name] }); err != nil {
+		log.Fatal(err)
+	}
+
+	stats, err := importRecords(ctx, conn, records)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			log.Fatalf("%v (run make db-migrate-up first)", err)
+		}
+		log.Fatal(err)
+	}
+	fmt.Printf("%d interactions: %d inserted, %d updated, %d unchanged\n", len(records), stats.inserted, stats.updated, stats.unchanged)
+}
+
+// classNamesFromDB returns the lowercase class names defined in drug_class_members, which the
+// server merges into the registry at startup. A missing table yields none.
+func classNamesFromDB(ctx context.Context, conn *pgx.Conn) (map[string]bool, error) {
+	rows, err := conn.Query(ctx, `select distinct lower(class_name) from drug_class_members`)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(names))
+	for _, name := range names {
+		out[name] = true
+	}
+	return out, nil
+}
+
+func readDataset(path, format, defaultSource string) ([]record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var parse func(io.Reader, string) ([]record, error)
+	switch format {
+	case "csv":
+		parse = parseCSV
+	case "json":
+		parse = parseJSON
+	default:
+		return nil, fmt.Errorf("unknown format %q (use -format csv or json)", format)
+	}
+	return parse(f, defaultSource)
+}
+
+// importRecords upserts every record in one transaction, so a failed import leaves the table as
+// it was.
+func importRecords(ctx context.Context, conn *pgx.Conn, records []record) (importStats, error) {
+	var stats importStats
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("begin import: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after commit
+
+	for _, r := range records {
+		var inserted bool
+		err := tx.QueryRow(ctx, `
+			insert into drug_interactions (kind_a, drug_a, kind_b, drug_b, severity, note, source, evidence_level, refs)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			on conflict (kind_a, drug_a, kind_b, drug_b, source) do update set
+				severity = excluded.severity,
+				note = excluded.note,
+				evidence_level = excluded.evidence_level,
+				refs = excluded.refs,
+				updated_at = now()
+			where (drug_interactions.severity, drug_interactions.note, drug_interactions.evidence_level, drug_interactions.refs)
+				is distinct from (excluded.severity, excluded.note, excluded.evidence_level, excluded.refs)
+			returning (xmax = 0)
+		`, r.KindA, r.DrugA, r.KindB, r.DrugB, r.Severity, r.Note, r.Source, r.EvidenceLevel, r.References).Scan(&inserted)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// The row exists with identical content; the conditional update skipped it.
+			stats.unchanged++
+		case err != nil:
+			return stats, fmt.Errorf("upsert %s + %s (%s): %w", label(r.KindA, r.DrugA), label(r.KindB, r.DrugB), r.Source, err)
+		case inserted:
+			stats.inserted++
+		default:
+			stats.updated++
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return stats, fmt.Errorf("commit import: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultAssessmentPageSize = 20
+	maxAssessmentPageSize     = 100
+)
+
+var (
+	errAssessmentNotFound = errors.New("assessment not found")
+	uuidRe                = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// Assessment is the immutable record of one diagnostic run.
+type Assessment struct {
+	ID              string           `json:"id"`
+	Endpoint        string           `json:"endpoint"`
+	Provider        string           `json:"provider"`
+	RulePackVersion string           `json:"rulePackVersion"`
+	RulePackHash    string           `json:"rulePackHash"`
+	Request         PatientData      `json:"request"`
+	Result          DiagnosticResult `json:"result"`
+	RequestedAt     time.Time        `json:"requestedAt"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	Reviews         []Review         `json:"reviews"`
+}
+
+// AssessmentSummary is the list view of an assessment.
+type AssessmentSummary struct {
+	ID              string    `json:"id"`
+	Endpoint        string    `json:"endpoint"`
+	Provider        string    `json:"provider"`
+	RulePackVersion string    `json:"rulePackVersion"`
+	RiskLevel       string    `json:"riskLevel"`
+	RiskScore       int       `json:"riskScore"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// assessmentStore persists assessments and their reviews. Records are append-only; Get returns an
+// assessment with its reviews in the order they were added.
+type assessmentStore interface {
+	Save(ctx context.Context, a *Assessment) error
+	Get(ctx context.Context, id string) (Assessment, error)
+	List(ctx context.Context, limit, offset int) ([]AssessmentSummary, int, error)
+	AddReview(ctx context.Context, r *Review) error
+}
+
+// newAssessment stamps a new record with an ID and the active rule pack.
+func newAssessment(endpoint, provider string, rules *loadedRulePack, req PatientData, result DiagnosticResult, requestedAt time.Time) *Assessment {
+	a := &Assessment{
+		ID:          newUUID(),
+		Reviews:     []Review{},
+		Endpoint:    endpoint,
+		Provider:    provider,
+		Request:     req,
+		Result:      result,
+		RequestedAt: requestedAt.UTC(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if rules != nil {
+		a.RulePackVersion = rules.Version
+		a.RulePackHash = rules.Hash
+	}
+	return a
+}
+
+// recordAssessment persists a completed run with its assessment.created audit entry and returns its
+// ID. It returns "" when persistence is disabled or the record could not be saved; that is logged
+// rather than failing the diagnostic response. An error means the assessment was saved but its
+// audit entry was not, which the caller must not hide.
+func recordAssessment(ctx context.Context, stores appStores, a *Assessment) (string, error) {
+	if stores.assessments == nil {
+		return "", nil
+	}
+	saved := false
+	err := auditedWrite(ctx, stores, auditAssessmentCreated, a.ID, func() any { return assessmentAuditPayload(a) }, func(tx pgx.Tx) error {
+		var err error
+		if tx != nil {
+			err = insertAssessment(ctx, tx, a)
+		} else {
+			err = stores.assessments.Save(ctx, a)
+		}
+		saved = err == nil && tx == nil
+		return err
+	})
+	if err != nil {
+		if saved {
+			return "", err
+		}
+		log.Printf("assessment persistence failed: %v", err)
+		return "", nil
+	}
+	return a.ID, nil
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func validUUID(id string) bool {
+	return uuidRe.MatchString(strings.ToLower(id))
+}
+
+// pgAssessmentStore keeps assessments in the assessments table (migrations/0003_assessments.sql).
+type pgAssessmentStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s *pgAssessmentStore) Save(ctx context.Context, a *Assessment) error {
+	return insertAssessment(ctx, s.pool, a)
+}
+
+// pgExecer is the Exec method shared by *pgxpool.Pool and pgx.Tx.
+type pgExecer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertAssessment(ctx context.Context, db pgExecer, a *Assessment) error {
+	request, err := json.Marshal(a.Request)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	result, err := json.Marshal(a.Result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+	_, err = db.Exec(ctx, `
+		insert into assessments (id, endpoint, provider, rule_pack_version, rule_pack_hash, risk_level, risk_score, request, result, requested_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, a.ID, a.Endpoint, a.Provider, a.RulePackVersion, a.RulePackHash, a.Result.RiskLevel, a.Result.RiskScore, request, result, a.RequestedAt, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert assessment: %w", err)
+	}
+	return nil
+}
+
+func (s *pgAssessmentStore) Get(ctx context.Context, id string) (Assessment, error) {
+	if !validUUID(id) {
+		return Assessment{}, errAssessmentNotFound
+	}
+	var a Assessment
+	var request, result []byte
+	err := s.pool.QueryRow(ctx, `
+		select id::text, endpoint, provider, rule_pack_version, rule_pack_hash, request, result, requested_at, created_at
+		from assessments
+		where id = $1
+	`, id).Scan(&a.ID, &a.Endpoint, &a.Provider, &a.RulePackVersion, &a.RulePackHash, &request, &result, &a.RequestedAt, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "does not exist") {
+			return Assessment{}, errAssessmentNotFound
+		}
+		return Assessment{}, err
+	}
+	if err := json.Unmarshal(request, &a.Request); err != nil {
+		return Assessment{}, fmt.Errorf("decode request: %w", err)
+	}
+	if err := json.Unmarshal(result, &a.Result); err != nil {
+		return Assessment{}, fmt.Errorf("decode result: %w", err)
+	}
+	if a.Reviews, err = s.reviews(ctx, a.ID); err != nil {
+		return Assessment{}, err
+	}
+	return a, nil
+}
+
+func (s *pgAssessmentStore) List(ctx context.Context, limit, offset int) ([]AssessmentSummary, int, error) {
+	var total int
+	if err := s.pool.QueryRow(ctx, `select count(*) from assessments`).Scan(&total); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			// Table not provisioned yet; treat as no data.
+			return []AssessmentSummary{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		select id::text, endpoint, provider, rule_pack_version, risk_level, risk_score, created_at
+		from assessments
+		order by created_at desc, id
+		limit $1 offset $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []AssessmentSummary{}
+	for rows.Next() {
+		var a AssessmentSummary
+		if err := rows.Scan(&a.ID, &a.Endpoint, &a.Provider, &a.RulePackVersion, &a.RiskLevel, &a.RiskScore, &a.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, a)
+	}
+	return out, total, rows.Err()
+}
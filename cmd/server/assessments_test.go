@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeAssessmentStore struct {
+	mu      sync.Mutex
+	records []Assessment
+	reviews []Review
+}
+
+func (f *fakeAssessmentStore) Save(_ context.Context, a *Assessment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, *a)
+	return nil
+}
+
+func (f *fakeAssessmentStore) Get(_ context.Context, id string) (Assessment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range f.records {
+		if a.ID == id {
+			a.Reviews = []Review{}
+			for _, r := range f.reviews {
+				if r.AssessmentID == id {
+					a.Reviews = append(a.Reviews, r)
+				}
+			}
+			return a, nil
+		}
+	}
+	return Assessment{}, errAssessmentNotFound
+}
+
+func (f *fakeAssessmentStore) AddReview(_ context.Context, r *Review) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reviews = append(f.reviews, *r)
+	return nil
+}
+
+func (f *fakeAssessmentStore) List(_ context.Context, limit, offset int) ([]AssessmentSummary, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []AssessmentSummary{}
+	for i := len(f.records) - 1 - offset; i >= 0 && len(out) < limit; i-- {
+		a := f.records[i]
+		out = append(out, AssessmentSummary{ID: a.ID, Endpoint: a.Endpoint, Provider: a.Provider, RiskLevel: a.Result.RiskLevel})
+	}
+	return out, len(f.records), nil
+}
+
+func TestDiagnosticsPersistAssessments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeAssessmentStore{}
+	router := newRouter(nil, nil, ".", &Config{}, appStores{assessments: store})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex","medications":"nitroglycerin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	var result DiagnosticResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !validUUID(result.AssessmentID) || len(store.records) != 1 {
+		t.Fatalf("expected one persisted assessment, got id %q and %d records", result.AssessmentID, len(store.records))
+	}
+	saved := store.records[0]
+	if saved.Provider != "mock" || saved.RulePackVersion != activeRules.Load().Version || saved.Request.Name != "Alex" || saved.Result.RiskLevel != "HIGH" {
+		t.Fatalf("unexpected assessment record: %+v", saved)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/assessments/"+result.AssessmentID, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), result.AssessmentID) {
+		t.Fatalf("expected assessment lookup, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	cases := map[string]int{
+		"/api/assessments":                http.StatusOK,
+		"/api/assessments?limit=0":        http.StatusBadRequest,
+		"/api/assessments?offset=-1":      http.StatusBadRequest,
+		"/api/assessments/does-not-exist": http.StatusNotFound,
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d (%s)", path, want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAssessmentsDisabledWithoutDB(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/assessments", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a database, got %d", w.Code)
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	id := newUUID()
+	if !validUUID(id) || id[14] != '4' {
+		t.Fatalf("expected a version 4 UUID, got %q", id)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	auditAssessmentCreated  = "assessment.created"
+	auditAssessmentReviewed = "assessment.reviewed"
+	auditRulePackLoaded     = "rulepack.loaded"
+	auditConfigLoaded       = "config.loaded"
+
+	auditGenesisHash    = "sha256:genesis"
+	auditVerifyPageSize = 500
+)
+
+// AuditEntry is one link in the audit chain. Hash covers every other field, including the previous
+// entry's hash, so altering or removing any entry breaks every link after it.
+type AuditEntry struct {
+	Seq       int64           `json:"seq"`
+	Kind      string          `json:"kind"`
+	Subject   string          `json:"subject"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	PrevHash  string          `json:"prevHash"`
+	Hash      string          `json:"hash"`
+}
+
+// AuditAnchor is a chain position recorded outside the database, e.g. the seq and head of an
+// earlier verification. Entries removed from the end of the chain leave every remaining link
+// intact, so only a check against an anchor detects truncation.
+type AuditAnchor struct {
+	Seq  int64
+	Hash string
+}
+
+// AuditVerification is the result of walking the chain; BrokenAt is the first entry that fails.
+// Head and Entries (the head's seq) can be kept as an AuditAnchor for later checks.
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head,omitempty"`
+	BrokenAt *int64 `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// auditStore appends entries to the chain and pages through it in sequence order.
+type auditStore interface {
+	Append(ctx context.Context, kind, subject string, payload any) (AuditEntry, error)
+	Entries(ctx context.Context, afterSeq int64, limit int) ([]AuditEntry, error)
+}
+
+// nextAuditEntry builds the entry that follows prev (nil for the first entry).
+func nextAuditEntry(prev *AuditEntry, kind, subject string, payload any, now time.Time) (AuditEntry, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("marshal audit payload: %w", err)
+	}
+	entry := AuditEntry{
+		Seq:      1,
+		Kind:     kind,
+		Subject:  subject,
+		Payload:  raw,
+		PrevHash: auditGenesisHash,
+		// Postgres keeps microseconds; hash what will be read back.
+		CreatedAt: now.UTC().Truncate(time.Microsecond),
+	}
+	if prev != nil {
+		entry.Seq = prev.Seq + 1
+		entry.PrevHash = prev.Hash
+	}
+	entry.Hash = entry.computeHash()
+	return entry, nil
+}
+
+func (e AuditEntry) computeHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%s\n%s\n", e.Seq, e.Kind, e.Subject, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.PrevHash)
+	h.Write(e.Payload)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyAuditChain walks the whole chain and reports the first entry whose sequence, link or hash
+// does not check out. With an anchor, the entry at anchor.Seq must still exist with that hash;
+// without one, entries deleted from the end of the chain go unnoticed.
+func verifyAuditChain(ctx context.Context, store auditStore, anchor *AuditAnchor) (AuditVerification, error) {
+	out := AuditVerification{OK: true}
+	prevHash := auditGenesisHash
+	var prevSeq int64
+	for {
+		page, err := store.Entries(ctx, prevSeq, auditVerifyPageSize)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+		for _, e := range page {
+			reason := ""
+			switch {
+			case e.Seq != prevSeq+1:
+				reason = fmt.Sprintf("sequence gap: expected %d", prevSeq+1)
+			case e.PrevHash != prevHash:
+				reason = "prevHash does not match the previous entry"
+			case e.computeHash() != e.Hash:
+				reason = "hash does not match entry contents"
+			case anchor != nil && e.Seq == anchor.Seq && e.Hash != anchor.Hash:
+				reason = "hash does not match the anchor"
+			}
+			if reason != "" {
+				seq := e.Seq
+				out.OK, out.BrokenAt, out.Reason = false, &seq, reason
+				return out, nil
+			}
+			out.Entries++
+			out.Head = e.Hash
+			prevHash, prevSeq = e.Hash, e.Seq
+		}
+		if len(page) < auditVerifyPageSize {
+			if anchor != nil && anchor.Seq > prevSeq {
+				seq := anchor.Seq
+				out.OK, out.BrokenAt, out.Reason = false, &seq, fmt.Sprintf("chain ends at %d before the anchor: entries were removed", prevSeq)
+			}
+			return out, nil
+		}
+	}
+}
+
+// auditedWrite runs write and appends the audit entry describing it. When both stores are in
+// Postgres they share one transaction and write receives it; otherwise write receives nil and runs
+// first, and a failed append is returned so the caller does not report an unaudited record as saved.
+func auditedWrite(ctx context.Context, stores appStores, kind, subject string, payload func() any, write func(pgx.Tx) error) error {
+	_, txStores := stores.assessments.(*pgAssessmentStore)
+	if audit, ok := stores.audit.(*pgAuditStore); ok && txStores {
+		_, err := audit.appendWith(ctx, kind, subject, payload(), write)
+		return err
+	}
+	if err := write(nil); err != nil {
+		return err
+	}
+	if stores.audit == nil {
+		return nil
+	}
+	if _, err := stores.audit.Append(ctx, kind, subject, payload()); err != nil {
+		return fmt.Errorf("audit append (%s %s): %w", kind, subject, err)
+	}
+	return nil
+}
+
+// recordAudit appends to the audit chain, logging rather than failing the caller on error.
+func recordAudit(ctx context.Context, store auditStore, kind, subject string, payload any) {
+	if store == nil {
+		return
+	}
+	if _, err := store.Append(ctx, kind, subject, payload); err != nil {
+		log.Printf("audit append failed (%s %s): %v", kind, subject, err)
+	}
+}
+
+// assessmentAuditPayload summarizes an assessment for the audit chain; digest fingerprints the
+// stored request and result so the record itself can be checked against the chain.
+func assessmentAuditPayload(a *Assessment) map[string]any {
+	body, _ := json.Marshal(struct {
+		Request PatientData      `json:"request"`
+		Result  DiagnosticResult `json:"result"`
+	}{a.Request, a.Result})
+	sum := sha256.Sum256(body)
+	return map[string]any{
+		"endpoint":        a.Endpoint,
+		"provider":        a.Provider,
+		"rulePackVersion": a.RulePackVersion,
+		"rulePackHash":    a.RulePackHash,
+		"riskLevel":       a.Result.RiskLevel,
+		"medication":      a.Result.Plan.Medication,
+		"digest":          "sha256:" + hex.EncodeToString(sum[:]),
+	}
+}
+
+// configAuditPayload records the effective configuration without secrets.
+func configAuditPayload(cfg *Config) map[string]any {
+	return map[string]any{
+		"enableDB":            cfg.EnableDB,
+		"geminiConfigured":    cfg.GeminiAPIKey != "",
+		"openAIConfigured":    cfg.OpenAIAPIKey != "",
+		"openAIBaseURL":       cfg.OpenAIBaseURL,
+		"openAIModel":         cfg.OpenAIModel,
+		"geminiModel":         cfg.GeminiModel,
+		"providers":           cfg.Providers,
+		"rulesPath":           cfg.RulesPath,
+		"drugClassesPath":     cfg.DrugClassesPath,
+		"rulesReloadInterval": cfg.RulesReloadInterval.String(),
+		"providerFallback":    cfg.ProviderFallback,
+		"breakerThreshold":    cfg.BreakerThreshold,
+		"breakerCooldown":     cfg.BreakerCooldown.String(),
+		"authApiKeys":         len(cfg.APIKeys),
+		"authJwt":             len(cfg.JWTKeys) > 0,
+		"rateLimitLLM":        cfg.RateLimitLLM.String(),
+		"rateLimitRules":      cfg.RateLimitRules.String(),
+		"quotaDailyTokens":    cfg.QuotaDailyTokens,
+		"quotaDailyCostUSD":   cfg.QuotaDailyCostUSD,
+		"phiRedaction":        getOr(cfg.PHIRedaction, redactionPseudonymize),
+		"corsAllowedOrigins":  cfg.CORSAllowedOrigins,
+		"corsCredentials":     cfg.CORSAllowCredentials,
+		"trustedProxies":      cfg.TrustedProxies,
+		"rxnormConcepts":      cfg.RxNormPath,
+		"rxnavFallback":       cfg.RxNavFallback,
+		"rxnavCacheSize":      cfg.RxNavCacheSize,
+		"rxnavCacheTTL":       cfg.RxNavCacheTTL.String(),
+		"rxnavCacheDB":        cfg.RxNavCacheDB,
+		"rxnavConcurrency":    cfg.RxNavConcurrency,
+		"rxnavLookupTimeout":  cfg.RxNavLookupTimeout.String(),
+		"rxnavRetries":        cfg.RxNavRetries,
+		"interactionMode":     cfg.InteractionMode,
+	}
+}
+
+// recordConfigAudit records the effective configuration, including the rule pack now in force.
+// It runs at startup and again on every rule pack reload.
+func recordConfigAudit(ctx context.Context, store auditStore, subject string, cfg *Config, rules *loadedRulePack) {
+	payload := configAuditPayload(cfg)
+	payload["rulePackVersion"] = rules.Version
+	payload["rulePackHash"] = rules.Hash
+	recordAudit(ctx, store, auditConfigLoaded, subject, payload)
+	recordAudit(ctx, store, auditRulePackLoaded, rules.Version, rulePackAuditPayload(rules))
+}
+
+func rulePackAuditPayload(rules *loadedRulePack) map[string]any {
+	return map[string]any{
+		"version": rules.Version,
+		"hash":    rules.Hash,
+		"source":  rules.Source,
+		"rules":   len(rules.Pack.Rules),
+	}
+}
+
+// memoryAuditStore keeps the chain in process memory. It is used when the database is disabled
+// and in tests.
+type memoryAuditStore struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	now     func() time.Time
+}
+
+func newMemoryAuditStore() *memoryAuditStore {
+	return &memoryAuditStore{now: time.Now}
+}
+
+func (s *memoryAuditStore) Append(_ context.Context, kind, subject string, payload any) (AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var prev *AuditEntry
+	if n := len(s.entries); n > 0 {
+		prev = &s.entries[n-1]
+	}
+	entry, err := nextAuditEntry(prev, kind, subject, payload, s.now())
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	s.entries = append(s.entries, entry)
+	return entry, nil
+}
+
+func (s *memoryAuditStore) Entries(_ context.Context, afterSeq int64, limit int) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []AuditEntry{}
+	for _, e := range s.entries {
+		if e.Seq > afterSeq && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// pgAuditStore keeps the chain in the audit_log table (migrations/0005_audit_log.sql). Appends
+// take a transaction-scoped advisory lock so concurrent writers extend the chain one at a time.
+type pgAuditStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s *pgAuditStore) Append(ctx context.Context, kind, subject string, payload any) (AuditEntry, error) {
+	return s.appendWith(ctx, kind, subject, payload, nil)
+}
+
+// appendWith appends an entry and, when write is non-nil, runs write in the same transaction first,
+// so a record and the audit entry describing it commit or roll back together.
+func (s *pgAuditStore) appendWith(ctx context.Context, kind, subject string, payload any, write func(pgx.Tx) error) (AuditEntry, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("begin audit append: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after commit
+
+	if write != nil {
+		if err := write(tx); err != nil {
+			return AuditEntry{}, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext('audit_log'))`); err != nil {
+		return AuditEntry{}, fmt.Errorf("lock audit chain: %w", err)
+	}
+	var prev *AuditEntry
+	var last AuditEntry
+	err = tx.QueryRow(ctx, `select seq, hash from audit_log order by seq desc limit 1`).Scan(&last.Seq, &last.Hash)
+	switch {
+	case err == nil:
+		prev = &last
+	case !errors.Is(err, pgx.ErrNoRows):
+		return AuditEntry{}, fmt.Errorf("read audit head: %w", err)
+	}
+
+	entry, err := nextAuditEntry(prev, kind, subject, payload, time.Now())
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	if _, err := tx.Exec(ctx, `
+		insert into audit_log (seq, kind, subject, payload, created_at, prev_hash, hash)
+		values ($1, $2, $3, $4, $5, $6, $7)
+	`, entry.Seq, entry.Kind, entry.Subject, string(entry.Payload), entry.CreatedAt, entry.PrevHash, entry.Hash); err != nil {
+		return AuditEntry{}, fmt.Errorf("insert audit entry: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return AuditEntry{}, fmt.Errorf("commit audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (s *pgAuditStore) Entries(ctx context.Context, afterSeq int64, limit int) ([]AuditEntry, error) {
+	rows, err := s.pool.Query(ctx, `
+		select seq, kind, subject, payload, created_at, prev_hash, hash
+		from audit_log
+		where seq > $1
+		order by seq
+		limit $2
+	`, afterSeq, limit)
+	if err != nil {
+		// A missing audit_log table is an error, not an empty chain: verification must not pass
+		// against a database that has lost or never had the table.
+		return nil, fmt.Errorf("read audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var payload string
+		if err := rows.Scan(&e.Seq, &e.Kind, &e.Subject, &payload, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditChainVerify(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAuditStore()
+	for i, kind := range []string{auditConfigLoaded, auditRulePackLoaded, auditAssessmentCreated} {
+		if _, err := store.Append(ctx, kind, "subject", map[string]int{"n": i}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	got, err := verifyAuditChain(ctx, store, nil)
+	if err != nil || !got.OK || got.Entries != 3 || got.Head != store.entries[2].Hash {
+		t.Fatalf("expected intact chain of 3, got %+v (%v)", got, err)
+	}
+
+	store.entries[1].Payload = json.RawMessage(`{"n":42}`)
+	got, _ = verifyAuditChain(ctx, store, nil)
+	if got.OK || got.BrokenAt == nil || *got.BrokenAt != 2 || got.Entries != 1 {
+		t.Fatalf("expected tampered payload to break at seq 2, got %+v", got)
+	}
+
+	store.entries[1].Payload = json.RawMessage(`{"n":1}`)
+	store.entries = append(store.entries[:1], store.entries[2:]...)
+	got, _ = verifyAuditChain(ctx, store, nil)
+	if got.OK || got.BrokenAt == nil || *got.BrokenAt != 3 || !strings.Contains(got.Reason, "sequence gap") {
+		t.Fatalf("expected removed entry to be reported, got %+v", got)
+	}
+}
+
+func TestAuditChainAnchorDetectsTruncation(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAuditStore()
+	for i := 0; i < 3; i++ {
+		if _, err := store.Append(ctx, auditAssessmentCreated, "subject", map[string]int{"n": i}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	head, _ := verifyAuditChain(ctx, store, nil)
+	anchor := &AuditAnchor{Seq: head.Entries, Hash: head.Head}
+	if got, _ := verifyAuditChain(ctx, store, anchor); !got.OK {
+		t.Fatalf("expected the chain to match its own head, got %+v", got)
+	}
+
+	store.entries = store.entries[:2]
+	if got, _ := verifyAuditChain(ctx, store, nil); !got.OK {
+		t.Fatalf("without an anchor truncation is expected to go unnoticed, got %+v", got)
+	}
+	got, _ := verifyAuditChain(ctx, store, anchor)
+	if got.OK || got.BrokenAt == nil || *got.BrokenAt != 3 || !strings.Contains(got.Reason, "removed") {
+		t.Fatalf("expected truncation to be reported against the anchor, got %+v", got)
+	}
+
+	got, _ = verifyAuditChain(ctx, store, &AuditAnchor{Seq: 2, Hash: "sha256:other"})
+	if got.OK || got.BrokenAt == nil || *got.BrokenAt != 2 {
+		t.Fatalf("expected a mismatched anchor to be reported, got %+v", got)
+	}
+}
+
+func TestRecordConfigAuditIncludesRulePack(t *testing.T) {
+	store := newMemoryAuditStore()
+	rules := &loadedRulePack{Pack: &RulePack{}, Version: "v2", Hash: "sha256:abc"}
+	recordConfigAudit(context.Background(), store, "reload: sighup", &Config{RulesPath: "rules.yaml"}, rules)
+	if len(store.entries) != 2 || store.entries[0].Kind != auditConfigLoaded || store.entries[0].Subject != "reload: sighup" || store.entries[1].Kind != auditRulePackLoaded {
+		t.Fatalf("unexpected audit entries: %+v", store.entries)
+	}
+	if !strings.Contains(string(store.entries[0].Payload), `"rulePackVersion":"v2"`) {
+		t.Fatalf("expected the config entry to name the pack in force, got %s", store.entries[0].Payload)
+	}
+}
+
+func TestAuditRecordsAssessmentsAndReviews(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	audit := newMemoryAuditStore()
+	router := newRouter(nil, nil, ".", &Config{}, appStores{assessments: &fakeAssessmentStore{}, audit: audit})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	var result DiagnosticResult
+	_ = json.Unmarshal(w.Body.Bytes(), &result)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/assessments/"+result.AssessmentID+"/review", strings.NewReader(`{"reviewer":"Dr. Smith","plan":{"dosage":"2.5mg"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected review to be created, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	if len(audit.entries) != 2 || audit.entries[0].Kind != auditAssessmentCreated || audit.entries[1].Kind != auditAssessmentReviewed || audit.entries[0].Subject != result.AssessmentID {
+		t.Fatalf("unexpected audit entries: %+v", audit.entries)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/audit/verify", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok":true`) {
+		t.Fatalf("expected verified chain, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	head := audit.entries[1].Hash
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/audit/verify?seq=3&hash="+head, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"brokenAt":3`) {
+		t.Fatalf("expected a missing anchored entry to fail, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	audit.entries[0].Subject = "someone-else"
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/audit/verify", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"brokenAt":1`) {
+		t.Fatalf("expected broken chain at seq 1, got %d (%s)", w.Code, w.Body.String())
+	}
+}
+
+type failingAuditStore struct{ memoryAuditStore }
+
+func (*failingAuditStore) Append(context.Context, string, string, any) (AuditEntry, error) {
+	return AuditEntry{}, errors.New("audit_log unavailable")
+}
+
+func TestAuditFailureFailsAssessmentRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter(nil, nil, ".", &Config{}, appStores{assessments: &fakeAssessmentStore{}, audit: &failingAuditStore{}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "audit_write_failed") {
+		t.Fatalf("expected an unaudited assessment to fail the request, got %d (%s)", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleClinician = "clinician"
+	roleReviewer  = "reviewer"
+	roleAdmin     = "admin"
+
+	principalKey      = "principal"
+	jwtClockSkew      = time.Minute
+	apiKeyHeader      = "X-API-Key"
+	defaultRolesClaim = "roles"
+)
+
+var (
+	knownRoles = []string{roleClinician, roleReviewer, roleAdmin}
+
+	errNoCredentials      = errors.New("no credentials")
+	errInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	Method  string   `json:"method"` // api_key|jwt
+}
+
+// hasRole reports whether the principal holds role; admin holds every role.
+func (p *Principal) hasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role || r == roleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator resolves request credentials to a principal. It returns errNoCredentials when the
+// request carries nothing it understands so the next authenticator can try.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// authChain tries each authenticator in order; an empty chain disables authentication.
+type authChain []Authenticator
+
+func newAuthChain(cfg *Config) authChain {
+	var chain authChain
+	if len(cfg.APIKeys) > 0 {
+		chain = append(chain, apiKeyAuthenticator(cfg.APIKeys))
+	}
+	if len(cfg.JWTKeys) > 0 {
+		chain = append(chain, &jwtAuthenticator{
+			keys:       cfg.JWTKeys,
+			issuer:     cfg.JWTIssuer,
+			audience:   cfg.JWTAudience,
+			rolesClaim: getOr(cfg.JWTRolesClaim, defaultRolesClaim),
+			now:        time.Now,
+		})
+	}
+	return chain
+}
+
+// methods lists the enabled credential types for /api/config.
+func (c authChain) methods() []string {
+	out := []string{}
+	for _, a := range c {
+		switch a.(type) {
+		case apiKeyAuthenticator:
+			out = append(out, "api_key")
+		case *jwtAuthenticator:
+			out = append(out, "jwt")
+		}
+	}
+	return out
+}
+
+func (c authChain) enabled() bool { return len(c) > 0 }
+
+func (c authChain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, errNoCredentials
+}
+
+// authenticate resolves the caller once per request and stores the principal in the gin context.
+// With authentication disabled every request passes anonymously.
+func authenticate(chain authChain) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !chain.enabled() {
+			c.Next()
+			return
+		}
+		p, err := chain.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="gorocky"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// requireRole admits principals holding any of roles. It is a no-op when authentication is disabled.
+func requireRole(chain authChain, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !chain.enabled() {
+			c.Next()
+			return
+		}
+		p := principalFrom(c)
+		if p == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		for _, role := range roles {
+			if p.hasRole(role) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "required": roles})
+	}
+}
+
+func principalFrom(c *gin.Context) *Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if p, ok := v.(*Principal); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// bearerToken returns the token from "Authorization: Bearer <token>", or "".
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// isJWT distinguishes compact JWTs from opaque API keys sent as bearer tokens.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// apiKeyAuthenticator maps static keys to principals. Keys are accepted in X-API-Key or as a
+// non-JWT bearer token.
+type apiKeyAuthenticator map[string]Principal
+
+func (a apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		if token := bearerToken(r); token != "" && !isJWT(token) {
+			key = token
+		}
+	}
+	if key == "" {
+		return nil, errNoCredentials
+	}
+	for candidate, p := range a {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return &p, nil
+		}
+	}
+	return nil, errInvalidCredentials
+}
+
+// parseAPIKeys parses "name:key=role|role; other:key2=admin" into key -> principal. The name is
+// what audit records and reviews attribute actions to.
+func parseAPIKeys(raw string) (map[string]Principal, error) {
+	out := map[string]Principal{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ident, roleList, ok := strings.Cut(entry, "=")
+		name, key, hasName := strings.Cut(ident, ":")
+		if !hasName {
+			name, key = "", ident
+		}
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected \"name:key=role|role\", got %q", redactKey(entry))
+		}
+		roles, err := parseRoles(strings.Split(roleList, "|"))
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = "api-key-" + redactKey(key)
+		}
+		out[key] = Principal{Subject: name, Roles: roles, Method: "api_key"}
+	}
+	return out, nil
+}
+
+func parseRoles(raw []string) ([]string, error) {
+	var roles []string
+	for _, r := range raw {
+		r = strings.ToLower(strings.TrimSpace(r))
+		if r == "" {
+			continue
+		}
+		if !containsString(knownRoles, r) {
+			return nil, fmt.Errorf("unknown role %q (known: %s)", r, strings.Join(knownRoles, ", "))
+		}
+		roles = append(roles, r)
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("at least one role is required")
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// redactKey keeps only a short prefix of a secret for messages.
+func redactKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
+
+// jwtAuthenticator verifies bearer JWTs (RS256/384/512, ES256/384) against a JWKS file and reads
+// roles from rolesClaim, which may be a dotted path such as "realm_access.roles".
+type jwtAuthenticator struct {
+	keys       map[string]crypto.PublicKey
+	issuer     string
+	audience   string
+	rolesClaim string
+	now        func() time.Time
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" || !isJWT(token) {
+		return nil, errNoCredentials
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCredentials, err)
+	}
+
+	var roleValues []string
+	switch v := lookupClaim(claims, a.rolesClaim).(type) {
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				roleValues = append(roleValues, s)
+			}
+		}
+	case string:
+		roleValues = strings.Fields(v)
+	}
+	// Unrecognized roles from the identity provider are ignored rather than rejected.
+	var roles []string
+	for _, role := range roleValues {
+		if role = strings.ToLower(role); containsString(knownRoles, role) && !containsString(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	subject, _ := claims["sub"].(string)
+	return &Principal{Subject: subject, Roles: roles, Method: "jwt"}, nil
+}
+
+// verify checks the signature and registered claims and returns the claim set.
+func (a *jwtAuthenticator) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("parse header: %w", err)
+	}
+	key, ok := a.keys[header.Kid]
+	if !ok && header.Kid == "" && len(a.keys) == 1 {
+		for _, only := range a.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("parse claims: %w", err)
+	}
+
+	now := a.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("missing exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtClockSkew)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if a.audience != "" && !audienceMatches(claims["aud"], a.audience) {
+		return nil, fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	// The subject is who gets audited and signs reviews; a token without one identifies nobody.
+	if sub, _ := claims["sub"].(string); strings.TrimSpace(sub) == "" {
+		return nil, errors.New("missing sub")
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	digest := hashBytes(hash, signed)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("alg %q does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return fmt.Errorf("alg %q does not match EC key", alg)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported key type")
+	}
+	return nil
+}
+
+func hashBytes(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
+
+func audienceMatches(aud any, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lookupClaim(claims map[string]any, path string) any {
+	var cur any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// loadJWKS reads RSA and EC signing keys from a JWKS file, keyed by kid.
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS %s: %w", path, err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", path, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := jwkPublicKey(k.Kty, k.N, k.E, k.Crv, k.X, k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %s key %d (%s): %w", path, i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no signing keys", path)
+	}
+	return keys, nil
+}
+
+func jwkPublicKey(kty, n, e, crv, x, y string) (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("invalid base64url parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch kty {
+	case "RSA":
+		modulus, err := decode(n)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := decode(e)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var check ecdh.Curve
+		switch crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		px, err := decode(x)
+		if err != nil {
+			return nil, err
+		}
+		py, err := decode(y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		// FillBytes panics on a coordinate longer than the curve size.
+		if len(px.Bytes()) > size || len(py.Bytes()) > size {
+			return nil, errors.New("invalid point size")
+		}
+		point := append([]byte{4}, append(px.FillBytes(make([]byte, size)), py.FillBytes(make([]byte, size))...)...)
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: px, Y: py}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", kty)
+	}
+}
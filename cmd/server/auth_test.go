@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	raw, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	return path
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys("alice:k-clin=clinician|reviewer; ops:k-admin=ADMIN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := keys["k-clin"]; p.Subject != "alice" || strings.Join(p.Roles, ",") != "clinician,reviewer" {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+	for _, bad := range []string{"alice:k1", "alice:k1=superuser", "alice:=clinician"} {
+		if _, err := parseAPIKeys(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRBACWithAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, _ := parseAPIKeys("alice:k-clin=clinician; bob:k-rev=reviewer; ops:k-admin=admin")
+	router := setupRouter(nil, nil, ".", &Config{APIKeys: keys})
+
+	cases := []struct {
+		method, path, key string
+		want              int
+	}{
+		{"POST", "/api/diagnostics/mock", "", http.StatusUnauthorized},
+		{"POST", "/api/diagnostics/mock", "wrong", http.StatusUnauthorized},
+		{"POST", "/api/diagnostics/mock", "k-rev", http.StatusForbidden},
+		{"POST", "/api/diagnostics/mock", "k-clin", http.StatusOK},
+		{"POST", "/api/diagnostics/mock", "k-admin", http.StatusOK},
+		{"GET", "/api/rules", "k-clin", http.StatusForbidden},
+		{"GET", "/api/rules", "k-admin", http.StatusOK},
+		{"GET", "/api/audit/verify", "k-admin", http.StatusOK},
+		{"GET", "/healthz", "", http.StatusOK},
+		{"GET", "/api/config", "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.key != "" {
+			req.Header.Set(apiKeyHeader, tc.key)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s with key %q: expected %d, got %d (%s)", tc.method, tc.path, tc.key, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys, err := loadJWKS(writeJWKS(t, rsaKey, ecKey))
+	if err != nil {
+		t.Fatalf("load jwks: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		JWTKeys:       keys,
+		JWTIssuer:     "https://idp.example",
+		JWTAudience:   "gorocky",
+		JWTRolesClaim: "realm_access.roles",
+	})
+	claims := func(roles []string, exp time.Time) map[string]any {
+		return map[string]any{
+			"sub": "dr-smith", "iss": "https://idp.example", "aud": []string{"gorocky"},
+			"exp": exp.Unix(), "realm_access": map[string]any{"roles": roles},
+		}
+	}
+	valid := time.Now().Add(time.Hour)
+	withSub := func(sub any) map[string]any {
+		c := claims([]string{"clinician"}, valid)
+		if sub == nil {
+			delete(c, "sub")
+		} else {
+			c["sub"] = sub
+		}
+		return c
+	}
+
+	cases := map[string]struct {
+		token string
+		want  int
+	}{
+		"rs256 clinician": {signJWT(t, "RS256", "rsa-1", rsaKey, claims([]string{"clinician", "offline_access"}, valid)), http.StatusOK},
+		"es256 clinician": {signJWT(t, "ES256", "ec-1", ecKey, claims([]string{"clinician"}, valid)), http.StatusOK},
+		"reviewer only":   {signJWT(t, "RS256", "rsa-1", rsaKey, claims([]string{"reviewer"}, valid)), http.StatusForbidden},
+		"expired":         {signJWT(t, "RS256", "rsa-1", rsaKey, claims([]string{"clinician"}, time.Now().Add(-time.Hour))), http.StatusUnauthorized},
+		"wrong key":       {signJWT(t, "RS256", "ec-1", rsaKey, claims([]string{"clinician"}, valid)), http.StatusUnauthorized},
+		"unknown kid":     {signJWT(t, "RS256", "rsa-9", rsaKey, claims([]string{"clinician"}, valid)), http.StatusUnauthorized},
+		"missing sub":     {signJWT(t, "RS256", "rsa-1", rsaKey, withSub(nil)), http.StatusUnauthorized},
+		"empty sub":       {signJWT(t, "RS256", "rsa-1", rsaKey, withSub("")), http.StatusUnauthorized},
+		"non-string sub":  {signJWT(t, "RS256", "rsa-1", rsaKey, withSub(42)), http.StatusUnauthorized},
+	}
+	for name, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d (%s)", name, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	other := claims([]string{"clinician"}, valid)
+	other["aud"] = "someone-else"
+	a := newAuthChain(&Config{JWTKeys: keys, JWTAudience: "gorocky"})
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, "RS256", "rsa-1", rsaKey, other))
+	if _, err := a.Authenticate(req); err == nil {
+		t.Fatal("expected audience mismatch to be rejected")
+	}
+}
+
+func TestJWKRejectsOversizedCoordinate(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	x := b64(ecKey.X.FillBytes(make([]byte, 32)))
+	oversized := b64(append([]byte{1}, make([]byte, 32)...))
+	if _, err := jwkPublicKey("EC", "", "", "P-256", oversized, x); err == nil {
+		t.Fatal("expected error for a 33-byte x coordinate")
+	}
+	if _, err := jwkPublicKey("EC", "", "", "P-256", x, oversized); err == nil {
+		t.Fatal("expected error for a 33-byte y coordinate")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Fatal("expected breaker to stay closed below the threshold")
+	}
+	b.failure()
+	if b.allow() || b.status().State != breakerOpen {
+		t.Fatalf("expected breaker to open after 2 failures, got %+v", b.status())
+	}
+	if until := b.status().OpenUntil; until == nil || !until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected openUntil %v", until)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("expected a trial call after the cool-down")
+	}
+	if b.allow() {
+		t.Fatal("expected only one trial call while half-open")
+	}
+	b.failure()
+	if b.status().State != breakerOpen {
+		t.Fatalf("expected failed trial to re-open the breaker, got %+v", b.status())
+	}
+
+	now = now.Add(time.Minute)
+	b.allow()
+	b.success()
+	if st := b.status(); st.State != breakerClosed || st.Failures != 0 {
+		t.Fatalf("expected successful trial to close the breaker, got %+v", st)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/Skufu/GoRocky/internal/drugclasses"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DrugClass is one class of the registry file (internal/drugclasses/drug_classes.yaml).
+type DrugClass = drugclasses.Class
+
+// drugTerm is one matchable name (generic or synonym) split into lowercase words.
+type drugTerm struct {
+	generic string
+	name    string
+	words   []string
+}
+
+// combinationProduct is a product name that stands for several active ingredients.
+type combinationProduct struct {
+	name        string
+	words       []string
+	ingredients []string
+}
+
+// drugClassRegistry resolves free-text medication tokens to drug classes.
+type drugClassRegistry struct {
+	classes      map[string]DrugClass
+	terms        map[string][]drugTerm
+	combinations []combinationProduct
+}
+
+// drugClasses holds the active registry. It starts as the bundled default through a package-level
+// initializer rather than init, so it is in place before any init function (such as the default
+// rule pack's validation) runs, whatever the file order.
+var drugClasses = func() *atomic.Pointer[drugClassRegistry] {
+	reg, err := loadDrugClasses("")
+	if err != nil {
+		panic(err)
+	}
+	var p atomic.Pointer[drugClassRegistry]
+	p.Store(reg)
+	return &p
+}()
+
+// loadDrugClasses reads a registry file. An empty path yields the bundled default registry.
+func loadDrugClasses(path string) (*drugClassRegistry, error) {
+	file, err := drugclasses.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	reg := newDrugClassRegistry(file.Classes)
+	names := make([]string, 0, len(file.Combinations))
+	for name := range file.Combinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := reg.addCombination(name, file.Combinations[name]); err != nil {
+			return nil, fmt.Errorf("drug classes: %w", err)
+		}
+	}
+	return reg, nil
+}
+
+func newDrugClassRegistry(classes map[string]DrugClass) *drugClassRegistry {
+	reg := &drugClassRegistry{
+		classes: make(map[string]DrugClass, len(classes)),
+		terms:   make(map[string][]drugTerm, len(classes)),
+	}
+	for name, class := range classes {
+		reg.add(name, class)
+	}
+	return reg
+}
+
+// add merges a class (or extra members of an existing class) into the registry. Class names match
+// case-insensitively, so "alphablockers" extends alphaBlockers rather than starting a new class.
+func (r *drugClassRegistry) add(name string, class DrugClass) {
+	name = r.canonicalName(strings.TrimSpace(name))
+	existing, ok := r.classes[name]
+	if !ok {
+		existing = DrugClass{Label: class.Label, Members: map[string][]string{}}
+	}
+	if existing.Label == "" {
+		existing.Label = class.Label
+	}
+	for generic, synonyms := range class.Members {
+		generic = strings.ToLower(strings.TrimSpace(generic))
+		if generic == "" {
+			continue
+		}
+		if _, seen := existing.Members[generic]; !seen {
+			existing.Members[generic] = nil
+			r.addTerm(name, generic, generic)
+		}
+		for _, syn := range synonyms {
+			syn = strings.ToLower(strings.TrimSpace(syn))
+			if syn == "" || containsString(existing.Members[generic], syn) {
+				continue
+			}
+			existing.Members[generic] = append(existing.Members[generic], syn)
+			r.addTerm(name, generic, syn)
+		}
+	}
+	r.classes[name] = existing
+}
+
+// canonicalName returns the registered spelling of a class name, or name itself for a new class.
+func (r *drugClassRegistry) canonicalName(name string) string {
+	if _, ok := r.classes[name]; ok {
+		return name
+	}
+	for existing := range r.classes {
+		if strings.EqualFold(existing, name) {
+			return existing
+		}
+	}
+	return name
+}
+
+func (r *drugClassRegistry) addTerm(class, generic, name string) {
+	words := medWords(name)
+	if len(words) == 0 {
+		return
+	}
+	r.terms[class] = append(r.terms[class], drugTerm{generic: generic, name: name, words: words})
+}
+
+func (r *drugClassRegistry) addCombination(name string, ingredients []string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	var clean []string
+	for _, ing := range ingredients {
+		if ing = strings.ToLower(strings.TrimSpace(ing)); ing != "" && !containsString(clean, ing) {
+			clean = append(clean, ing)
+		}
+	}
+	if len(medWords(name)) == 0 || len(clean) < 2 {
+		return fmt.Errorf("combination %q needs a name and at least two ingredients", name)
+	}
+	r.combinations = append(r.combinations, combinationProduct{name: name, words: medWords(name), ingredients: clean})
+	return nil
+}
+
+// combination returns the ingredients of the combination product token names, if any.
+func (r *drugClassRegistry) combination(token string) []string {
+	words := medWords(token)
+	for _, c := range r.combinations {
+		if containsWords(words, c.words) {
+			return c.ingredients
+		}
+	}
+	return nil
+}
+
+func (r *drugClassRegistry) has(className string) bool {
+	_, ok := r.classes[className]
+	return ok
+}
+
+func (r *drugClassRegistry) hasGeneric(generic string) bool {
+	for _, class := range r.classes {
+		if _, ok := class.Members[generic]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *drugClassRegistry) names() []string {
+	out := make([]string, 0, len(r.classes))
+	for name := range r.classes {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// match returns the first token that names a member of className and the generic it resolved to.
+// When several terms match a token the most specific (longest) one wins, so "isosorbide mononitrate"
+// resolves to that generic rather than to plain "isosorbide".
+func (r *drugClassRegistry) match(tokens []string, className string) (token, generic string, ok bool) {
+	terms := r.terms[className]
+	for _, t := range tokens {
+		words := medWords(t)
+		best := -1
+		for i, term := range terms {
+			if containsWords(words, term.words) && (best < 0 || len(term.words) > len(terms[best].words)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return t, terms[best].generic, true
+		}
+	}
+	return "", "", false
+}
+
+// resolve maps a medication name to its generic and every class it belongs to.
+func (r *drugClassRegistry) resolve(name string) (generic string, classes []string) {
+	for _, className := range r.names() {
+		if _, g, ok := r.match([]string{name}, className); ok {
+			if generic == "" {
+				generic = g
+			}
+			classes = append(classes, className)
+		}
+	}
+	return generic, classes
+}
+
+// withDB returns a copy of the registry extended with rows from the drug_class_members table.
+func (r *drugClassRegistry) withDB(ctx context.Context, db *pgxpool.Pool) (*drugClassRegistry, error) {
+	rows, err := db.Query(ctx, `select class_name, generic, synonym from drug_class_members`)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return r, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	extra := make(map[string]DrugClass)
+	for rows.Next() {
+		var className, generic, synonym string
+		if err := rows.Scan(&className, &generic, &synonym); err != nil {
+			return nil, err
+		}
+		class, ok := extra[className]
+		if !ok {
+			class = DrugClass{Members: map[string][]string{}}
+		}
+		if synonym != "" {
+			class.Members[generic] = append(class.Members[generic], synonym)
+		} else if _, ok := class.Members[generic]; !ok {
+			class.Members[generic] = nil
+		}
+		extra[className] = class
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	merged := newDrugClassRegistry(r.classes)
+	merged.combinations = r.combinations
+	for name, class := range extra {
+		merged.add(name, class)
+	}
+	return merged, nil
+}
+
+// medWords lowercases text and splits it into alphanumeric words ("Nitro-Dur 0.4mg" -> nitro, dur, 0, 4mg).
+func medWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords reports whether needle appears as a contiguous run of whole words in haystack.
+func containsWords(haystack, needle []string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j, w := range needle {
+			if haystack[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
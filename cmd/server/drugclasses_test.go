@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestDrugClassRegistryBrandNamesAndAbbreviations(t *testing.T) {
+	cases := []struct {
+		token string
+		class string
+	}{
+		{"Viagra 50mg", "pde5i"},
+		{"cialis", "pde5i"},
+		{"GTN spray", "nitrates"},
+		{"Nitro-Dur patch", "nitrates"},
+		{"isosorbide mononitrate er", "nitrates"},
+		{"Flomax 0.4mg", "alphaBlockers"},
+		{"nizoral", "cyp3a4Inhibitors"},
+		{"tadalifil", "pde5i"},
+	}
+	for _, tc := range cases {
+		if !hasClassTokenByName(normalizeList(tc.token), tc.class) {
+			t.Errorf("expected %q to match class %s", tc.token, tc.class)
+		}
+	}
+}
+
+func TestDrugClassRegistryMatchesWholeWords(t *testing.T) {
+	if hasClassTokenByName([]string{"entgastrin"}, "nitrates") {
+		t.Fatal("abbreviation ntg must not match inside another word")
+	}
+	if hasClassTokenByName([]string{"viagra"}, "unknownClass") {
+		t.Fatal("unknown class must never match")
+	}
+}
+
+func TestDrugClassRegistryMergesNewClasses(t *testing.T) {
+	reg, err := loadDrugClasses("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.add("riociguat", DrugClass{Label: "sGC stimulators", Members: map[string][]string{"riociguat": {"adempas"}}})
+	reg.add("pde5i", DrugClass{Members: map[string][]string{"udenafil": {"zydena"}}})
+
+	if _, generic, ok := reg.match([]string{"adempas 1mg"}, "riociguat"); !ok || generic != "riociguat" {
+		t.Fatalf("expected new class to resolve, got %q %v", generic, ok)
+	}
+	if _, generic, ok := reg.match([]string{"zydena"}, "pde5i"); !ok || generic != "udenafil" {
+		t.Fatalf("expected new member to join existing class, got %q %v", generic, ok)
+	}
+	if _, _, ok := reg.match([]string{"viagra"}, "pde5i"); !ok {
+		t.Fatal("existing members must survive a merge")
+	}
+}
+
+func TestDrugClassRegistryMergesClassNamesCaseInsensitively(t *testing.T) {
+	reg, err := loadDrugClasses("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.add("alphablockers", DrugClass{Members: map[string][]string{"silodosin": {"rapaflo"}}})
+
+	if reg.has("alphablockers") {
+		t.Fatalf("expected the row to extend alphaBlockers, got classes %v", reg.names())
+	}
+	if _, generic, ok := reg.match([]string{"rapaflo"}, "alphaBlockers"); !ok || generic != "silodosin" {
+		t.Fatalf("expected new member to join alphaBlockers, got %q %v", generic, ok)
+	}
+}
+
+func TestMockAnalyze_BrandNames(t *testing.T) {
+	result := mockAnalyze(PatientData{Medications: "Viagra, Imdur"})
+	if result.RiskLevel != "HIGH" || result.Plan.Medication != "None" {
+		t.Fatalf("expected brand-name nitrate + PDE5i to block, got %+v", result)
+	}
+}
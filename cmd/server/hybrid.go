@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var findingKeyRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// mergeHybrid combines the deterministic engine result with a model result. Rule findings are
+// never dropped or downgraded; the model may add findings or raise severities. When the rules
+// raise a HIGH finding of any kind (including a dose cap) the rules plan stands regardless of what
+// the model recommended, and when the rules reduced the dose the model may not exceed it.
+func mergeHybrid(rules, model DiagnosticResult) DiagnosticResult {
+	merged := DiagnosticResult{
+		Source:    "rules+model",
+		Overrides: []string{},
+	}
+
+	merged.Interactions = mergeFindings(rules.Interactions, model.Interactions,
+		func(i Interaction) string { return i.Pair },
+		func(i *Interaction) *string { return &i.Severity },
+		func(i *Interaction) *string { return &i.Source })
+	merged.Contraindications = mergeFindings(rules.Contraindications, model.Contraindications,
+		func(c Contraindication) string { return c.ConditionOrAllergy },
+		func(c *Contraindication) *string { return &c.Severity },
+		func(c *Contraindication) *string { return &c.Source })
+	merged.DosingConcerns = mergeFindings(rules.DosingConcerns, model.DosingConcerns,
+		func(d DosingConcern) string { return d.Factor },
+		func(d *DosingConcern) *string { return &d.Severity },
+		func(d *DosingConcern) *string { return &d.Source })
+	merged.Issues = buildIssues(merged.Interactions, merged.Contraindications, merged.DosingConcerns)
+
+	merged.RiskScore = max(rules.RiskScore, model.RiskScore)
+	merged.RiskLevel = rules.RiskLevel
+	if severityRank(model.RiskLevel) > severityRank(rules.RiskLevel) {
+		merged.RiskLevel = model.RiskLevel
+	}
+
+	rulesBlocked := hasSeverity(rules.Interactions, "HIGH") || hasSeverityContra(rules.Contraindications, "HIGH") ||
+		hasSeverityDosing(rules.DosingConcerns, "HIGH")
+	switch {
+	case rulesBlocked:
+		merged.Plan = rules.Plan
+		merged.Alternatives = rules.Alternatives
+		merged.ConfidenceScore = rules.ConfidenceScore
+		merged.RecommendationConfidence = rules.RecommendationConfidence
+		if !strings.EqualFold(strings.TrimSpace(model.Plan.Medication), rules.Plan.Medication) {
+			merged.Overrides = append(merged.Overrides, fmt.Sprintf("model plan %q replaced by rules plan %q: HIGH safety blocker", model.Plan.Medication, rules.Plan.Medication))
+		} else if model.Plan.Dosage != rules.Plan.Dosage {
+			merged.Overrides = append(merged.Overrides, fmt.Sprintf("model dosage %q replaced by rules dosage %q: HIGH safety blocker", model.Plan.Dosage, rules.Plan.Dosage))
+		}
+		if severityRank(model.RiskLevel) < severityRank("HIGH") {
+			merged.Overrides = append(merged.Overrides, fmt.Sprintf("model risk level %q raised to HIGH: HIGH safety blocker", model.RiskLevel))
+		}
+	case model.Plan.Medication != "":
+		merged.Plan = model.Plan
+		merged.Alternatives = model.Alternatives
+		merged.ConfidenceScore = min(rules.ConfidenceScore, model.ConfidenceScore)
+		merged.RecommendationConfidence = model.RecommendationConfidence
+		if rules.doseReduced && exceedsPlanDose(model.Plan, rules.Plan) {
+			merged.Plan.Dosage = rules.Plan.Dosage
+			merged.Overrides = append(merged.Overrides, fmt.Sprintf("model dosage %q lowered to %q: rules require a reduced dose", model.Plan.Dosage, rules.Plan.Dosage))
+		}
+	default:
+		merged.Plan = rules.Plan
+		merged.Alternatives = rules.Alternatives
+		merged.ConfidenceScore = rules.ConfidenceScore
+		merged.RecommendationConfidence = rules.RecommendationConfidence
+	}
+	if merged.Alternatives == nil {
+		merged.Alternatives = []Alternative{}
+	}
+	return merged
+}
+
+// mergeFindings unions rule and model findings keyed on their normalized label. Matching findings
+// keep the higher severity and are attributed to "rules+model".
+func mergeFindings[T any](rules, model []T, label func(T) string, severity, source func(*T) *string) []T {
+	out := make([]T, 0, len(rules)+len(model))
+	index := make(map[string]int, len(rules))
+	for _, f := range rules {
+		*source(&f) = "rules"
+		index[findingKey(label(f))] = len(out)
+		out = append(out, f)
+	}
+	for _, f := range model {
+		key := findingKey(label(f))
+		if i, ok := index[key]; ok {
+			existing := &out[i]
+			if severityRank(*severity(&f)) > severityRank(*severity(existing)) {
+				*severity(existing) = *severity(&f)
+			}
+			*source(existing) = "rules+model"
+			continue
+		}
+		*source(&f) = "model"
+		index[key] = len(out)
+		out = append(out, f)
+	}
+	return out
+}
+
+// exceedsPlanDose reports whether model plans the rules plan's medication at a higher daily dose,
+// or at a dose that cannot be read.
+func exceedsPlanDose(model, rules Plan) bool {
+	if !strings.EqualFold(strings.TrimSpace(model.Medication), rules.Medication) {
+		return false
+	}
+	modelSig, _ := parseMedicationSig(model.Dosage)
+	rulesSig, _ := parseMedicationSig(rules.Dosage)
+	modelMg, ok := modelSig.dailyMg()
+	rulesMg, rulesOK := rulesSig.dailyMg()
+	return rulesOK && (!ok || modelMg > rulesMg)
+}
+
+func findingKey(label string) string {
+	return strings.Trim(findingKeyRe.ReplaceAllString(strings.ToLower(label), " "), " ")
+}
+
+func severityRank(severity string) int {
+	switch strings.ToUpper(severity) {
+	case "HIGH":
+		return 3
+	case "MEDIUM":
+		return 2
+	case "LOW":
+		return 1
+	default:
+		return 0
+	}
+}
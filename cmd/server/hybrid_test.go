@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergeHybridRulesWinOnHighBlocker(t *testing.T) {
+	rules := runSafetyEngine(PatientData{Medications: "sildenafil, nitroglycerin"})
+	model := DiagnosticResult{
+		RiskScore: 20,
+		RiskLevel: "LOW",
+		Interactions: []Interaction{
+			{Pair: "Nitrates + PDE5i", Severity: "LOW", Note: "model thinks it is fine"},
+			{Pair: "Sildenafil + Grapefruit", Severity: "LOW", Note: "dietary"},
+		},
+		Plan:            Plan{Medication: "Sildenafil", Dosage: "50mg PRN"},
+		ConfidenceScore: 0.9,
+	}
+
+	merged := mergeHybrid(rules, model)
+
+	if merged.Source != "rules+model" || merged.RiskLevel != "HIGH" || merged.Plan.Medication != "None" {
+		t.Fatalf("expected rules to keep the block, got %+v", merged)
+	}
+	if len(merged.Overrides) != 2 {
+		t.Fatalf("expected plan and risk overrides to be reported, got %v", merged.Overrides)
+	}
+	bySource := map[string]Interaction{}
+	for _, i := range merged.Interactions {
+		bySource[i.Source] = i
+	}
+	if shared := bySource["rules+model"]; shared.Severity != "HIGH" {
+		t.Fatalf("model must not downgrade the nitrate block, got %+v", merged.Interactions)
+	}
+	if _, ok := bySource["model"]; !ok {
+		t.Fatalf("expected model-only interaction to be kept, got %+v", merged.Interactions)
+	}
+}
+
+func TestMergeHybridUsesModelPlanWithoutBlockers(t *testing.T) {
+	rules := runSafetyEngine(PatientData{Age: 70})
+	model := DiagnosticResult{
+		RiskLevel:       "MEDIUM",
+		DosingConcerns:  []DosingConcern{{Factor: "Age >65", Severity: "HIGH", Recommendation: "start low"}},
+		Plan:            Plan{Medication: "Tadalafil", Dosage: "2.5mg Daily"},
+		ConfidenceScore: 0.95,
+	}
+
+	merged := mergeHybrid(rules, model)
+
+	if merged.Plan.Dosage != "2.5mg Daily" || len(merged.Overrides) != 0 {
+		t.Fatalf("expected model plan without overrides, got %+v", merged)
+	}
+	if merged.ConfidenceScore != rules.ConfidenceScore {
+		t.Fatalf("expected the lower confidence to win, got %v", merged.ConfidenceScore)
+	}
+	if len(merged.DosingConcerns) != 1 || merged.DosingConcerns[0].Severity != "HIGH" || merged.DosingConcerns[0].Source != "rules+model" {
+		t.Fatalf("expected model to raise severity of shared finding, got %+v", merged.DosingConcerns)
+	}
+}
+
+func TestHybridEndpointWithoutModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/hybrid", strings.NewReader(`{"name":"Alex"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without model keys, got %d", w.Code)
+	}
+}
+
+func TestMergeHybridRulesWinOnHighDoseCap(t *testing.T) {
+	rules := runSafetyEngine(PatientData{Conditions: []string{"Kidney Disease"}, Medications: "tadalafil 20mg"})
+	model := DiagnosticResult{
+		RiskLevel:       "LOW",
+		Plan:            Plan{Medication: "Tadalafil", Dosage: "20mg Daily"},
+		ConfidenceScore: 0.9,
+	}
+
+	merged := mergeHybrid(rules, model)
+
+	if merged.Plan != rules.Plan || merged.Plan.Dosage == model.Plan.Dosage {
+		t.Fatalf("expected the rules plan to stand over the renal dose cap, got %+v", merged.Plan)
+	}
+	if len(merged.Overrides) != 2 || !strings.Contains(merged.Overrides[0], "20mg Daily") {
+		t.Fatalf("expected plan and risk overrides to be reported, got %v", merged.Overrides)
+	}
+}
+
+func TestMergeHybridCapsModelDoseWhenRulesReduce(t *testing.T) {
+	rules := runSafetyEngine(PatientData{Conditions: []string{"Liver Disease"}, Medications: "tadalafil 20mg"})
+	if hasSeverityDosing(rules.DosingConcerns, "HIGH") || !rules.doseReduced {
+		t.Fatalf("expected a non-blocking dose reduction from the rules, got %+v", rules)
+	}
+	model := DiagnosticResult{
+		RiskLevel:       "MEDIUM",
+		Plan:            Plan{Medication: "Tadalafil", Dosage: "20mg Daily"},
+		ConfidenceScore: 0.9,
+	}
+
+	merged := mergeHybrid(rules, model)
+
+	if merged.Plan.Medication != "Tadalafil" || merged.Plan.Dosage != rules.Plan.Dosage {
+		t.Fatalf("expected the model dose to be lowered to %q, got %+v", rules.Plan.Dosage, merged.Plan)
+	}
+	if len(merged.Overrides) != 1 || !strings.Contains(merged.Overrides[0], "lowered") {
+		t.Fatalf("expected a dose override to be reported, got %v", merged.Overrides)
+	}
+}
+
+func TestHybridEndpointFallsBackToRulesOnProviderError(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{OpenAIBaseURL: failing.URL})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/hybrid?model=openai", strings.NewReader(`{"name":"Alex","medications":"sildenafil, nitroglycerin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the rules result when the model fails, got %d (%s)", w.Code, w.Body.String())
+	}
+	var result DiagnosticResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if result.Source != "rules" || result.Plan.Medication != "None" {
+		t.Fatalf("expected the rules result, got %+v", result)
+	}
+	if result.Fallback == nil || len(result.Fallback.Attempts) != 1 || result.Fallback.Attempts[0].Reason != "status_503" {
+		t.Fatalf("expected the failed attempt to be reported, got %+v", result.Fallback)
+	}
+}
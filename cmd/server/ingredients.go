@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	// saltWords name the salt or ester of an active ingredient ("sildenafil citrate"). They are only
+	// stripped after the first word, so "sodium bicarbonate" keeps its name.
+	saltWords = map[string]bool{
+		"acetate": true, "besylate": true, "besilate": true, "bitartrate": true, "bromide": true,
+		"calcium": true, "chloride": true, "citrate": true, "dihydrochloride": true, "fumarate": true,
+		"hcl": true, "hydrobromide": true, "hydrochloride": true, "hyclate": true, "maleate": true,
+		"mesylate": true, "magnesium": true, "phosphate": true, "potassium": true, "sodium": true,
+		"succinate": true, "sulfate": true, "sulphate": true, "tartrate": true, "tosylate": true,
+	}
+	// formWords name release forms and dosage forms ("isosorbide mononitrate ER tablet").
+	formWords = map[string]bool{
+		"er": true, "xr": true, "xl": true, "sr": true, "cr": true, "la": true, "dr": true, "ir": true,
+		"ec": true, "mr": true, "odt": true, "extended": true, "delayed": true, "modified": true,
+		"immediate": true, "release": true, "tablet": true, "tablets": true, "tab": true, "tabs": true,
+		"capsule": true, "capsules": true, "cap": true, "caps": true, "solution": true, "suspension": true,
+		"injection": true, "spray": true, "patch": true, "cream": true, "ointment": true, "film": true,
+	}
+	// combinationSeparators split free-text combinations such as "amlodipine/benazepril".
+	combinationSeparators = []string{"/", "+", " and ", " with "}
+)
+
+// activeIngredients maps a medication entry to its active ingredients: dose, route and frequency
+// are stripped, combination products are expanded, and salts and release forms are dropped.
+// Ingredients the drug-class registry knows are reported as its generic ("Viagra" -> sildenafil).
+func activeIngredients(token string) []string {
+	sig, ok := parseMedicationSig(token)
+	if !ok {
+		return nil
+	}
+	registry := drugClasses.Load()
+	parts := registry.combination(sig.Name)
+	if parts == nil {
+		parts = splitCombination(sig.Name)
+	}
+
+	var out []string
+	for _, part := range parts {
+		name := stripSaltAndForm(part)
+		if name == "" {
+			continue
+		}
+		if generic, _ := registry.resolve(name); generic != "" {
+			name = generic
+		}
+		if !containsString(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func splitCombination(name string) []string {
+	parts := []string{name}
+	for _, sep := range combinationSeparators {
+		var next []string
+		for _, p := range parts {
+			next = append(next, strings.Split(p, sep)...)
+		}
+		parts = next
+	}
+	return parts
+}
+
+// stripSaltAndForm drops strengths, salt names and release or dosage forms from one ingredient.
+func stripSaltAndForm(name string) string {
+	var kept []string
+	for i, w := range medWords(name) {
+		if formWords[w] || (i > 0 && saltWords[w]) || strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	return strings.Join(kept, " ")
+}
+
+// withIngredients returns tokens followed by the active ingredients of each token that are not
+// already listed, so class matching sees "nirmatrelvir" and "ritonavir" for "paxlovid". origin
+// maps each added ingredient to the token it came from.
+func withIngredients(tokens []string) (out []string, origin map[string]string) {
+	out = append([]string(nil), tokens...)
+	origin = map[string]string{}
+	for _, t := range tokens {
+		for _, ing := range activeIngredients(t) {
+			if !containsString(out, ing) {
+				out = append(out, ing)
+				origin[ing] = t
+			}
+		}
+	}
+	return out, origin
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestActiveIngredients(t *testing.T) {
+	cases := map[string]string{
+		"sildenafil citrate 50mg":              "sildenafil",
+		"Isosorbide Mononitrate ER 30mg daily": "isosorbide mononitrate",
+		"Viagra":                               "sildenafil",
+		"Paxlovid 300/100mg BID":               "nirmatrelvir,ritonavir",
+		"bidil":                                "isosorbide dinitrate,hydralazine",
+		"amlodipine besylate/benazepril HCl 5/20mg": "amlodipine,benazepril",
+		"metoprolol succinate XL tablet":            "metoprolol",
+		"sodium bicarbonate":                        "sodium bicarbonate",
+		"nitro-dur 0.4mg/hr patch":                  "nitroglycerin",
+	}
+	for token, want := range cases {
+		if got := strings.Join(activeIngredients(token), ","); got != want {
+			t.Errorf("activeIngredients(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
+
+func TestClassRulesSeeCombinationIngredients(t *testing.T) {
+	data := PatientData{Name: "Alex", Age: 50, Weight: 80, Height: 180, Medications: "Paxlovid, tadalafil 5mg"}
+	facts := newPatientFacts(data)
+	if !hasClassTokenByName(facts.meds, "cyp3a4Inhibitors") {
+		t.Fatalf("expected paxlovid to count as a CYP3A4 inhibitor, facts %v", facts.meds)
+	}
+	if facts.meds[0] != "paxlovid" {
+		t.Fatalf("original entries must come first, got %v", facts.meds)
+	}
+}
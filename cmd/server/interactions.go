@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// interactionModeMerge queries every configured source and merges the results.
+	interactionModeMerge = "merge"
+	// interactionModeFirst stops at the first source that returns interactions (DB, then RxNav).
+	interactionModeFirst = "first"
+
+	interactionSourceDB    = "db"
+	interactionSourceRxNav = "rxnav"
+
+	// interactionKindClass marks a drug_interactions side that names a drug class
+	// (migrations/0008_class_interactions.sql).
+	interactionKindClass = "class"
+)
+
+// mergeInteractions unions interactions from several sources keyed on the normalized drug pair.
+// A pair reported by more than one source keeps the highest severity (and that source's note) and
+// lists every source that reported it. Each interaction's Source names the source it came from.
+func mergeInteractions(sets ...[]Interaction) []Interaction {
+	out := []Interaction{}
+	index := map[string]int{}
+	for _, set := range sets {
+		for _, in := range set {
+			key := interactionPairKey(in.Pair)
+			i, ok := index[key]
+			if !ok {
+				in.Sources = []string{in.Source}
+				index[key] = len(out)
+				out = append(out, in)
+				continue
+			}
+			existing := &out[i]
+			if severityRank(in.Severity) > severityRank(existing.Severity) {
+				existing.Severity = in.Severity
+				existing.Note = in.Note
+				existing.RuleID = in.RuleID
+				existing.MatchedOn = in.MatchedOn
+				existing.Evidence = in.Evidence
+			}
+			if !containsString(existing.Sources, in.Source) {
+				existing.Sources = append(existing.Sources, in.Source)
+			}
+			for _, med := range in.Medications {
+				if !containsString(existing.Medications, med) {
+					existing.Medications = append(existing.Medications, med)
+				}
+			}
+		}
+	}
+	for i := range out {
+		out[i].Source = strings.Join(out[i].Sources, "+")
+	}
+	return out
+}
+
+// interactionPairKey normalizes "Sildenafil + Nitroglycerin" and "nitroglycerin + sildenafil" to
+// the same key.
+func interactionPairKey(pair string) string {
+	parts := strings.Split(pair, " + ")
+	for i, p := range parts {
+		parts[i] = normalizeDrugName(p)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+// withSource tags every interaction in set with source.
+func withSource(set []Interaction, source string) []Interaction {
+	for i := range set {
+		set[i].Source = source
+	}
+	return set
+}
+
+// interactionRow is one drug_interactions row; either side may name a drug class.
+type interactionRow struct {
+	id                         int64
+	kindA, drugA, kindB, drugB string
+	severity, note             string
+	refs                       []string
+}
+
+// interactionTerms indexes a medication list for the knowledge-base lookup: every name a row may
+// match (entries as given and their active ingredients) and every class those ingredients belong to.
+type interactionTerms struct {
+	entries map[string][]string // drug name -> medication entries that produced it
+	classes map[string][]string // lowercase class name -> member ingredients present
+}
+
+func newInteractionTerms(meds []string) interactionTerms {
+	t := interactionTerms{entries: map[string][]string{}, classes: map[string][]string{}}
+	registry := drugClasses.Load()
+	for _, med := range meds {
+		t.add(med, med)
+		for _, ing := range activeIngredients(med) {
+			t.add(ing, med)
+			_, classes := registry.resolve(ing)
+			for _, class := range classes {
+				class = strings.ToLower(class)
+				if !containsString(t.classes[class], ing) {
+					t.classes[class] = append(t.classes[class], ing)
+				}
+			}
+		}
+	}
+	return t
+}
+
+func (t interactionTerms) add(name, med string) {
+	if !containsString(t.entries[name], med) {
+		t.entries[name] = append(t.entries[name], med)
+	}
+}
+
+func (t interactionTerms) drugNames() []string {
+	return sortedKeys(t.entries)
+}
+
+func (t interactionTerms) classNames() []string {
+	return sortedKeys(t.classes)
+}
+
+// members expands one side of a row to the drug names it covers in this medication list.
+func (t interactionTerms) members(kind, name string) []string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if kind == interactionKindClass {
+		return t.classes[name]
+	}
+	if _, ok := t.entries[name]; ok {
+		return []string{name}
+	}
+	return nil
+}
+
+// interactions turns matched rows into one interaction per drug pair. A class row yields a pair for
+// each member present, and a pair matched by several rows keeps the highest severity.
+func (t interactionTerms) interactions(rows []interactionRow) []Interaction {
+	out := []Interaction{}
+	index := map[string]int{}
+	for _, row := range rows {
+		sev := strings.ToUpper(strings.TrimSpace(row.severity))
+		if severityRank(sev) == 0 {
+			sev = "MEDIUM"
+		}
+		for _, a := range t.members(row.kindA, row.drugA) {
+			for _, b := range t.members(row.kindB, row.drugB) {
+				if a == b {
+					continue
+				}
+				first, second := min(a, b), max(a, b)
+				in := Interaction{
+					Pair:      first + " + " + second,
+					Severity:  sev,
+					Note:      row.note,
+					RuleID:    fmt.Sprintf("drug_interactions:%d", row.id),
+					MatchedOn: append(t.matchedOn(row.kindA, row.drugA, a), t.matchedOn(row.kindB, row.drugB, b)...),
+					Evidence:  row.refs,
+				}
+				for _, med := range append(t.entries[first], t.entries[second]...) {
+					if !containsString(in.Medications, med) {
+						in.Medications = append(in.Medications, med)
+					}
+				}
+				key := first + "|" + second
+				if i, ok := index[key]; ok {
+					if severityRank(sev) > severityRank(out[i].Severity) {
+						out[i] = in
+					}
+					continue
+				}
+				index[key] = len(out)
+				out = append(out, in)
+			}
+		}
+	}
+	return out
+}
+
+// matchedOn describes how the entries behind drug met one side of a row.
+func (t interactionTerms) matchedOn(kind, name, drug string) []MatchedInput {
+	criterion := "drug: " + strings.ToLower(strings.TrimSpace(name))
+	if kind == interactionKindClass {
+		criterion = "class: " + strings.ToLower(strings.TrimSpace(name))
+	}
+	var out []MatchedInput
+	for _, med := range t.entries[drug] {
+		in := MatchedInput{Field: "medications", Input: med, Criterion: criterion}
+		if med != drug {
+			in.Via = drug
+		}
+		out = append(out, in)
+	}
+	return out
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeInteractions(t *testing.T) {
+	db := withSource([]Interaction{
+		{Pair: "nitroglycerin + sildenafil", Severity: "MEDIUM", Note: "Local note"},
+		{Pair: "tadalafil + tamsulosin", Severity: "MEDIUM", Note: "Orthostatic hypotension"},
+	}, interactionSourceDB)
+	rx := withSource([]Interaction{
+		{Pair: "Sildenafil + Nitroglycerin", Severity: "HIGH", Note: "Profound hypotension"},
+		{Pair: "ketoconazole + vardenafil", Severity: "HIGH", Note: "CYP3A4 inhibition"},
+		{Pair: "Tadalafil + Tamsulosin", Severity: "LOW", Note: "Minor"},
+	}, interactionSourceRxNav)
+
+	got := mergeInteractions(db, rx)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 merged pairs, got %+v", got)
+	}
+	nitrate := got[0]
+	if nitrate.Severity != "HIGH" || nitrate.Note != "Profound hypotension" || nitrate.Source != "db+rxnav" || strings.Join(nitrate.Sources, ",") != "db,rxnav" {
+		t.Fatalf("expected highest severity with both sources, got %+v", nitrate)
+	}
+	if alpha := got[1]; alpha.Severity != "MEDIUM" || alpha.Note != "Orthostatic hypotension" || alpha.Source != "db+rxnav" {
+		t.Fatalf("lower severity must not replace the DB finding, got %+v", alpha)
+	}
+	if azole := got[2]; azole.Source != "rxnav" || strings.Join(azole.Sources, ",") != "rxnav" {
+		t.Fatalf("expected RxNav-only pair to be kept, got %+v", azole)
+	}
+
+	if empty := mergeInteractions(nil, nil); empty == nil || len(empty) != 0 {
+		t.Fatalf("expected empty non-nil slice, got %#v", empty)
+	}
+}
+
+func TestInteractionTermsExpandClassRows(t *testing.T) {
+	terms := newInteractionTerms([]string{"imdur 30mg", "paxlovid", "cialis 5mg", "sildenafil citrate"})
+	if got := strings.Join(terms.classNames(), ","); got != "cyp3a4inhibitors,nitrates,pde5i" {
+		t.Fatalf("unexpected classes %s", got)
+	}
+
+	got := terms.interactions([]interactionRow{
+		{kindA: "class", drugA: "nitrates", kindB: "class", drugB: "pde5i", severity: "HIGH", note: "Hypotension"},
+		{kindA: "class", drugA: "cyp3a4inhibitors", kindB: "drug", drugB: "tadalafil", severity: "MEDIUM", note: "Raised tadalafil levels"},
+		{kindA: "drug", drugA: "isosorbide mononitrate", kindB: "drug", drugB: "tadalafil", severity: "LOW", note: "Drug-level row"},
+		{kindA: "class", drugA: "alphablockers", kindB: "class", drugB: "pde5i", severity: "MEDIUM"},
+	})
+	pairs := map[string]Interaction{}
+	for _, in := range got {
+		pairs[in.Pair] = in
+	}
+	if len(pairs) != 3 {
+		t.Fatalf("expected nitrate pairs for both PDE5 inhibitors plus ritonavir, got %+v", got)
+	}
+	if in := pairs["isosorbide mononitrate + tadalafil"]; in.Severity != "HIGH" || in.Note != "Hypotension" || strings.Join(in.Medications, ",") != "imdur 30mg,cialis 5mg" {
+		t.Fatalf("class row must outrank the weaker drug row and keep entries, got %+v", in)
+	}
+	if in := pairs["isosorbide mononitrate + sildenafil"]; in.Severity != "HIGH" {
+		t.Fatalf("expected every class member to inherit the row, got %+v", in)
+	}
+	if in := pairs["ritonavir + tadalafil"]; in.Severity != "MEDIUM" || strings.Join(in.Medications, ",") != "paxlovid,cialis 5mg" {
+		t.Fatalf("expected drug-to-class row via the combination product, got %+v", in)
+	}
+	want := []MatchedInput{
+		{Field: "medications", Input: "paxlovid", Criterion: "class: cyp3a4inhibitors", Via: "ritonavir"},
+		{Field: "medications", Input: "cialis 5mg", Criterion: "drug: tadalafil", Via: "tadalafil"},
+	}
+	if in := pairs["ritonavir + tadalafil"]; len(in.MatchedOn) != 2 || in.MatchedOn[0] != want[0] || in.MatchedOn[1] != want[1] || in.RuleID != "drug_interactions:0" {
+		t.Fatalf("unexpected explanation %+v", in)
+	}
+}
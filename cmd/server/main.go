@@ -1,9 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,11 +13,11 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
@@ -27,11 +28,49 @@ type HealthChecker interface {
 }
 
 type Config struct {
-	Port         string
-	DatabaseURL  string
-	GeminiAPIKey string
-	OpenAIAPIKey string
-	EnableDB     bool
+	Port                 string
+	DatabaseURL          string
+	GeminiAPIKey         string
+	GeminiModel          string
+	OpenAIAPIKey         string
+	OpenAIBaseURL        string
+	OpenAIModel          string
+	OpenAIExtraHeaders   map[string]string
+	EnableDB             bool
+	RulesPath            string
+	DrugClassesPath      string
+	RulesReloadInterval  time.Duration
+	Providers            []string
+	ProviderFallback     []string
+	BreakerThreshold     int
+	BreakerCooldown      time.Duration
+	APIKeys              map[string]Principal
+	JWKSPath             string
+	JWTKeys              map[string]crypto.PublicKey
+	JWTIssuer            string
+	JWTAudience          string
+	JWTRolesClaim        string
+	RateLimitLLM         rateSpec
+	RateLimitRules       rateSpec
+	QuotaDailyTokens     int
+	QuotaDailyCostUSD    float64
+	TokenPrices          map[string]float64
+	PHIRedaction         string
+	PHIPseudonymKey      string
+	RxNormPath           string
+	RxNorm               *rxnormStore
+	RxNavFallback        bool
+	RxNavCacheSize       int
+	RxNavCacheTTL        time.Duration
+	RxNavCacheDB         bool
+	RxNavConcurrency     int
+	RxNavLookupTimeout   time.Duration
+	RxNavRetries         int
+	InteractionMode      string
+	CORSAllowedOrigins   []string
+	CORSAllowCredentials bool
+	CSPConnectSrc        []string
+	TrustedProxies       []string
 }
 
 type PatientData struct {
@@ -52,6 +91,11 @@ type PatientData struct {
 	Complaint         string   `json:"complaint"`
 }
 
+// ParsedMedications returns the structured form of the medications and medicationDetails fields.
+func (p PatientData) ParsedMedications() []MedicationSig {
+	return parsePatientMedications(p.Medications, p.MedicationDetails)
+}
+
 type Plan struct {
 	Medication string `json:"medication"`
 	Dosage     string `json:"dosage"`
@@ -71,24 +115,51 @@ type DiagnosticResult struct {
 	ConfidenceScore          float64                  `json:"confidenceScore"`
 	RecommendationConfidence RecommendationConfidence `json:"recommendationConfidence"`
 	Source                   string                   `json:"source"`
+	Model                    string                   `json:"model,omitempty"`
+	Overrides                []string                 `json:"overrides,omitempty"`
+	Fallback                 *FallbackReport          `json:"fallback,omitempty"`
+	AssessmentID             string                   `json:"assessmentId,omitempty"`
+	Usage                    *TokenUsage              `json:"usage,omitempty"`
+	Redaction                *RedactionReport         `json:"redaction,omitempty"`
+	Explain                  *RuleExplanation         `json:"explain,omitempty"`
+
+	// doseReduced is set by the rules engine when a reduceDose rule lowered the plan's dose.
+	doseReduced bool
 }
 
 type Interaction struct {
-	Pair     string `json:"pair"`
-	Severity string `json:"severity"`
-	Note     string `json:"note"`
+	Pair     string   `json:"pair"`
+	Severity string   `json:"severity"`
+	Note     string   `json:"note"`
+	Source   string   `json:"source,omitempty"`
+	Sources  []string `json:"sources,omitempty"`
+	// Medications are the entries, as given, whose active ingredients form the pair.
+	Medications []string       `json:"medications,omitempty"`
+	RuleID      string         `json:"ruleId,omitempty"`
+	MatchedOn   []MatchedInput `json:"matchedOn,omitempty"`
+	Evidence    []string       `json:"evidence,omitempty"`
 }
 
 type Contraindication struct {
-	ConditionOrAllergy string `json:"conditionOrAllergy"`
-	Severity           string `json:"severity"`
-	Note               string `json:"note"`
+	ConditionOrAllergy string         `json:"conditionOrAllergy"`
+	Severity           string         `json:"severity"`
+	Note               string         `json:"note"`
+	Source             string         `json:"source,omitempty"`
+	RuleID             string         `json:"ruleId,omitempty"`
+	MatchedOn          []MatchedInput `json:"matchedOn,omitempty"`
+	Evidence           []string       `json:"evidence,omitempty"`
 }
 
 type DosingConcern struct {
-	Factor         string `json:"factor"`
-	Severity       string `json:"severity"`
-	Recommendation string `json:"recommendation"`
+	Factor         string         `json:"factor"`
+	Severity       string         `json:"severity"`
+	Recommendation string         `json:"recommendation"`
+	ObservedDose   string         `json:"observedDose,omitempty"`
+	MaxDose        string         `json:"maxDose,omitempty"`
+	Source         string         `json:"source,omitempty"`
+	RuleID         string         `json:"ruleId,omitempty"`
+	MatchedOn      []MatchedInput `json:"matchedOn,omitempty"`
+	Evidence       []string       `json:"evidence,omitempty"`
 }
 
 type Alternative struct {
@@ -105,7 +176,8 @@ type InteractionCheckResponse struct {
 	Resolved     []string      `json:"resolved"`
 	Unresolved   []string      `json:"unresolved"`
 	Warnings     []string      `json:"warnings"`
-	Source       string        `json:"source"` // db|rxnav|none
+	Source       string        `json:"source"` // db|rxnav|db+rxnav|none
+	Matches      []RxNormMatch `json:"matches,omitempty"`
 }
 
 type validationError struct {
@@ -117,7 +189,7 @@ const systemPrompt = `
 You are GoRocky Clinical AI, a high-precision medical decision support engine.
 Analyze the patient intake data and provide a structured JSON treatment plan.
 
-Patient intake fields: name, age, weight, height, BMI, blood pressure, lifestyle (smoking, alcohol, exercise), conditions, medications (with details), allergies, complaint.
+Patient intake fields: patient reference (pseudonymous, may be absent), age, weight, height, BMI, blood pressure, lifestyle (smoking, alcohol, exercise), conditions, medications (with details), allergies, complaint.
 
 *** CRITICAL MEDICAL RULES (STRICT ENFORCEMENT) ***
 1. [CONTRAINDICATION - HIGH] Nitrates (Nitroglycerin, Isosorbide) + PDE5 inhibitors (Sildenafil, Tadalafil, Vardenafil, Avanafil) -> Risk of profound hypotension. Do NOT co-administer.
@@ -150,40 +222,10 @@ Return valid JSON (no markdown) matching:
 }
 `
 
-var (
-	pde5iClass        = []string{"sildenafil", "tadalafil", "vardenafil", "avanafil"}
-	nitrateClass      = []string{"nitroglycerin", "isosorbide", "isosorbide dinitrate", "isosorbide mononitrate"}
-	alphaBlockerClass = []string{"tamsulosin", "doxazosin", "terazosin", "alfuzosin"}
-	cyp3a4Class       = []string{"ketoconazole", "itraconazole", "ritonavir", "cobicistat", "clarithromycin"}
-	ruleDB            = []Rule{
-		{ID: "nitrates+pde5i", Type: "interaction", Severity: "HIGH", Match: RuleMatch{DrugClassA: "nitrates", DrugClassB: "pde5i"}, Note: "Risk of profound hypotension; avoid co-administration."},
-		{ID: "alpha+pde5i", Type: "interaction", Severity: "MEDIUM", Match: RuleMatch{DrugClassA: "alphaBlockers", DrugClassB: "pde5i"}, Note: "Additive hypotension; separate dosing and start low."},
-		{ID: "cyp3a4+pde5i", Type: "interaction", Severity: "MEDIUM", Match: RuleMatch{DrugClassA: "cyp3a4Inhibitors", DrugClassB: "pde5i"}, Note: "Higher PDE5i levels; use lowest dose and monitor."},
-		{ID: "pregnancy+pde5i", Type: "contra", Severity: "MEDIUM", Match: RuleMatch{Condition: "pregnant", RequiresDrugClass: "pde5i"}, Note: "Safety in pregnancy not established; avoid PDE5 inhibitors."},
-		{ID: "renal+pde5i", Type: "dosing", Severity: "MEDIUM", Match: RuleMatch{Condition: "kidney disease"}, Note: "Max 2.5-5mg daily; monitor closely."},
-	}
-	severityWeight = map[string]int{
-		"HIGH":   40,
-		"MEDIUM": 20,
-		"LOW":    10,
-	}
-	httpClient = &http.Client{Timeout: 15 * time.Second}
-)
-
-type Rule struct {
-	ID       string    `json:"id"`
-	Type     string    `json:"type"` // interaction|contra|dosing
-	Severity string    `json:"severity"`
-	Match    RuleMatch `json:"match"`
-	Note     string    `json:"note"`
-}
+var httpClient = &http.Client{Timeout: 15 * time.Second}
 
-type RuleMatch struct {
-	DrugClassA        string `json:"drugClassA"`
-	DrugClassB        string `json:"drugClassB"`
-	Condition         string `json:"condition"`
-	RequiresDrugClass string `json:"requiresDrugClass"`
-}
+// rxnavBaseURL is the RxNav REST root; tests point it at a local server.
+var rxnavBaseURL = "https://rxnav.nlm.nih.gov/REST"
 
 func main() {
 	gin.SetMode(getEnv("GIN_MODE", "release"))
@@ -193,6 +235,11 @@ func main() {
 		log.Fatalf("config error: %v", err)
 	}
 
+	classes, err := loadDrugClasses(cfg.DrugClassesPath)
+	if err != nil {
+		log.Fatalf("drug class registry error: %v", err)
+	}
+
 	ctx := context.Background()
 	var db HealthChecker
 	var dbPool *pgxpool.Pool
@@ -203,10 +250,32 @@ func main() {
 		}
 		db = dbPool
 		defer dbPool.Close()
+
+		classes, err = classes.withDB(ctx, dbPool)
+		if err != nil {
+			log.Fatalf("drug class registry error: %v", err)
+		}
+	}
+	drugClasses.Store(classes)
+	log.Printf("loaded drug class registry (%s)", strings.Join(classes.names(), ", "))
+
+	rules, err := loadRulePack(cfg.RulesPath)
+	if err != nil {
+		log.Fatalf("rule pack error: %v", err)
+	}
+	activeRules.Store(rules)
+	log.Printf("loaded rule pack version %s (%d rules, %s)", rules.Version, len(rules.Pack.Rules), rules.Hash)
+
+	stores := storesFor(dbPool)
+	recordConfigAudit(ctx, stores.audit, "startup", cfg, rules)
+	if cfg.RulesPath != "" {
+		go watchRulePack(ctx, cfg.RulesPath, cfg.RulesReloadInterval, func(r *loadedRulePack, reason string) {
+			recordConfigAudit(ctx, stores.audit, "reload: "+reason, cfg, r)
+		})
 	}
 
 	staticRoot := detectStaticRoot()
-	router := setupRouter(db, dbPool, staticRoot, cfg)
+	router := newRouter(db, dbPool, staticRoot, cfg, stores)
 	server := &http.Server{
 		Addr:              ":" + cfg.Port,
 		Handler:           router,
@@ -230,11 +299,142 @@ func loadConfig() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		Port:         getEnv("PORT", "8080"),
-		DatabaseURL:  os.Getenv("DATABASE_URL"),
-		GeminiAPIKey: os.Getenv("GEMINI_API_KEY"),
-		OpenAIAPIKey: os.Getenv("OPENAI_API_KEY"),
-		EnableDB:     strings.EqualFold(getEnv("ENABLE_DB", "false"), "true"),
+		Port:            getEnv("PORT", "8080"),
+		DatabaseURL:     os.Getenv("DATABASE_URL"),
+		GeminiAPIKey:    os.Getenv("GEMINI_API_KEY"),
+		OpenAIAPIKey:    os.Getenv("OPENAI_API_KEY"),
+		OpenAIBaseURL:   os.Getenv("OPENAI_BASE_URL"),
+		OpenAIModel:     os.Getenv("OPENAI_MODEL"),
+		GeminiModel:     os.Getenv("GEMINI_MODEL"),
+		EnableDB:        strings.EqualFold(getEnv("ENABLE_DB", "false"), "true"),
+		RulesPath:       os.Getenv("RULES_PATH"),
+		DrugClassesPath: os.Getenv("DRUG_CLASSES_PATH"),
+		JWKSPath:        os.Getenv("JWT_JWKS_PATH"),
+		JWTIssuer:       os.Getenv("JWT_ISSUER"),
+		JWTAudience:     os.Getenv("JWT_AUDIENCE"),
+		JWTRolesClaim:   getEnv("JWT_ROLES_CLAIM", defaultRolesClaim),
+	}
+
+	interval, err := time.ParseDuration(getEnv("RULES_RELOAD_INTERVAL", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RULES_RELOAD_INTERVAL: %w", err)
+	}
+	cfg.RulesReloadInterval = interval
+
+	headers, err := parseHeaderList(os.Getenv("OPENAI_EXTRA_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPENAI_EXTRA_HEADERS: %w", err)
+	}
+	cfg.OpenAIExtraHeaders = headers
+	if cfg.OpenAIBaseURL != "" {
+		if u, err := url.Parse(cfg.OpenAIBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid OPENAI_BASE_URL %q", cfg.OpenAIBaseURL)
+		}
+	}
+
+	if cfg.Providers, err = parseProviderList(os.Getenv("PROVIDERS")); err != nil {
+		return nil, fmt.Errorf("invalid PROVIDERS: %w", err)
+	}
+	for _, name := range strings.Split(os.Getenv("PROVIDER_FALLBACK"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+			continue
+		case name == "rules":
+			name = mockProviderName
+		case name == mockProviderName, containsString(cfg.Providers, name):
+		default:
+			return nil, fmt.Errorf("invalid PROVIDER_FALLBACK: unknown or disabled provider %q", name)
+		}
+		cfg.ProviderFallback = append(cfg.ProviderFallback, name)
+	}
+	threshold, err := strconv.Atoi(getEnv("BREAKER_FAILURE_THRESHOLD", strconv.Itoa(defaultBreakerThreshold)))
+	if err != nil || threshold < 1 {
+		return nil, fmt.Errorf("invalid BREAKER_FAILURE_THRESHOLD: must be a positive integer")
+	}
+	cfg.BreakerThreshold = threshold
+	cooldown, err := time.ParseDuration(getEnv("BREAKER_COOLDOWN", defaultBreakerCooldown.String()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BREAKER_COOLDOWN: %w", err)
+	}
+	cfg.BreakerCooldown = cooldown
+
+	if cfg.RateLimitLLM, err = parseRateSpec(getEnv("RATE_LIMIT_LLM", "20/m")); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_LLM: %w", err)
+	}
+	if cfg.RateLimitRules, err = parseRateSpec(getEnv("RATE_LIMIT_RULES", "120/m")); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_RULES: %w", err)
+	}
+	if cfg.QuotaDailyTokens, err = strconv.Atoi(getEnv("QUOTA_DAILY_TOKENS", "0")); err != nil || cfg.QuotaDailyTokens < 0 {
+		return nil, fmt.Errorf("invalid QUOTA_DAILY_TOKENS: must be a non-negative integer")
+	}
+	if cfg.QuotaDailyCostUSD, err = strconv.ParseFloat(getEnv("QUOTA_DAILY_COST_USD", "0"), 64); err != nil || cfg.QuotaDailyCostUSD < 0 {
+		return nil, fmt.Errorf("invalid QUOTA_DAILY_COST_USD: must be a non-negative number")
+	}
+	if cfg.TokenPrices, err = parsePriceList(os.Getenv("LLM_PRICE_PER_1K_TOKENS")); err != nil {
+		return nil, fmt.Errorf("invalid LLM_PRICE_PER_1K_TOKENS: %w", err)
+	}
+	if cfg.QuotaDailyCostUSD > 0 && len(cfg.TokenPrices) == 0 {
+		return nil, fmt.Errorf("invalid QUOTA_DAILY_COST_USD: LLM_PRICE_PER_1K_TOKENS must price at least one provider")
+	}
+
+	cfg.PHIRedaction = strings.ToLower(getEnv("PHI_REDACTION", redactionPseudonymize))
+	if !validRedactionMode(cfg.PHIRedaction) {
+		return nil, fmt.Errorf("invalid PHI_REDACTION %q: expected off, strip or pseudonymize", cfg.PHIRedaction)
+	}
+	cfg.PHIPseudonymKey = os.Getenv("PHI_PSEUDONYM_KEY")
+
+	if cfg.CORSAllowedOrigins, err = parseOriginList(os.Getenv("CORS_ALLOWED_ORIGINS")); err != nil {
+		return nil, fmt.Errorf("invalid CORS_ALLOWED_ORIGINS: %w", err)
+	}
+	cfg.CORSAllowCredentials = strings.EqualFold(getEnv("CORS_ALLOW_CREDENTIALS", "false"), "true")
+	if cfg.CORSAllowCredentials && containsString(cfg.CORSAllowedOrigins, "*") {
+		return nil, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS: credentials cannot be allowed for every origin (*)")
+	}
+	if cfg.CSPConnectSrc, err = parseOriginList(os.Getenv("CSP_CONNECT_SRC")); err != nil {
+		return nil, fmt.Errorf("invalid CSP_CONNECT_SRC: %w", err)
+	}
+
+	if cfg.TrustedProxies, err = parseProxyList(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	cfg.RxNormPath = os.Getenv("RXNORM_CONCEPTS_PATH")
+	if cfg.RxNormPath != "" {
+		if cfg.RxNorm, err = loadRxNormConcepts(cfg.RxNormPath); err != nil {
+			return nil, fmt.Errorf("invalid RXNORM_CONCEPTS_PATH: %w", err)
+		}
+	}
+	cfg.RxNavFallback = strings.EqualFold(getEnv("RXNAV_FALLBACK", "false"), "true")
+	if cfg.RxNavCacheSize, err = strconv.Atoi(getEnv("RXNAV_CACHE_SIZE", strconv.Itoa(defaultRxNavCacheSize))); err != nil || cfg.RxNavCacheSize < 0 {
+		return nil, fmt.Errorf("invalid RXNAV_CACHE_SIZE: must be a non-negative integer")
+	}
+	if cfg.RxNavCacheTTL, err = time.ParseDuration(getEnv("RXNAV_CACHE_TTL", defaultRxNavCacheTTL.String())); err != nil {
+		return nil, fmt.Errorf("invalid RXNAV_CACHE_TTL: %w", err)
+	}
+	cfg.RxNavCacheDB = strings.EqualFold(getEnv("RXNAV_CACHE_DB", "false"), "true")
+	if cfg.RxNavConcurrency, err = strconv.Atoi(getEnv("RXNAV_CONCURRENCY", strconv.Itoa(defaultRxNavConcurrency))); err != nil || cfg.RxNavConcurrency < 1 {
+		return nil, fmt.Errorf("invalid RXNAV_CONCURRENCY: must be a positive integer")
+	}
+	if cfg.RxNavLookupTimeout, err = time.ParseDuration(getEnv("RXNAV_LOOKUP_TIMEOUT", defaultRxNavLookupTimeout.String())); err != nil {
+		return nil, fmt.Errorf("invalid RXNAV_LOOKUP_TIMEOUT: %w", err)
+	}
+	switch cfg.InteractionMode = strings.ToLower(getEnv("INTERACTION_SOURCE_MODE", interactionModeMerge)); cfg.InteractionMode {
+	case interactionModeMerge, interactionModeFirst:
+	default:
+		return nil, fmt.Errorf("invalid INTERACTION_SOURCE_MODE %q: must be merge or first", cfg.InteractionMode)
+	}
+	if cfg.RxNavRetries, err = strconv.Atoi(getEnv("RXNAV_RETRIES", strconv.Itoa(defaultRxNavRetries))); err != nil || cfg.RxNavRetries < 0 {
+		return nil, fmt.Errorf("invalid RXNAV_RETRIES: must be a non-negative integer")
+	}
+
+	if cfg.APIKeys, err = parseAPIKeys(os.Getenv("API_KEYS")); err != nil {
+		return nil, fmt.Errorf("invalid API_KEYS: %w", err)
+	}
+	if cfg.JWKSPath != "" {
+		if cfg.JWTKeys, err = loadJWKS(cfg.JWKSPath); err != nil {
+			return nil, fmt.Errorf("invalid JWT_JWKS_PATH: %w", err)
+		}
 	}
 
 	if cfg.EnableDB && cfg.DatabaseURL == "" {
@@ -244,6 +444,24 @@ func loadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// parseHeaderList parses "Name: value; Other-Name: value" into a header map.
+func parseHeaderList(raw string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected \"Name: value\", got %q", entry)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
 func connectDB(ctx context.Context, rawURL string) (*pgxpool.Pool, error) {
 	cleanURL := sanitizeDatabaseURL(rawURL)
 	cfg, err := pgxpool.ParseConfig(cleanURL)
@@ -290,18 +508,70 @@ func sanitizeDatabaseURL(raw string) string {
 	return parsed.String()
 }
 
+// appStores groups the persistence backends used by the router; nil members are disabled.
+type appStores struct {
+	assessments assessmentStore
+	audit       auditStore
+	rxnavCache  cacheBackend
+}
+
+// storesFor returns the Postgres-backed stores, or an in-memory audit chain when the database is
+// disabled.
+func storesFor(dbPool *pgxpool.Pool) appStores {
+	if dbPool == nil {
+		return appStores{audit: newMemoryAuditStore()}
+	}
+	return appStores{
+		assessments: &pgAssessmentStore{pool: dbPool},
+		audit:       &pgAuditStore{pool: dbPool},
+		rxnavCache:  &pgCacheBackend{pool: dbPool},
+	}
+}
+
 func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg *Config) *gin.Engine {
+	return newRouter(db, dbPool, staticRoot, cfg, storesFor(dbPool))
+}
+
+func newRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg *Config, stores appStores) *gin.Engine {
+	providers := newProviderRegistry(cfg)
+	rxcuis := newRxcuiResolver(cfg.RxNorm, cfg.RxNavFallback)
+	var cacheBackend cacheBackend
+	if cfg.RxNavCacheDB {
+		cacheBackend = stores.rxnavCache
+	}
+	rxcuis.cache = newRxNavCaches(cfg.RxNavCacheSize, cfg.RxNavCacheTTL, cacheBackend)
+	if cfg.RxNavConcurrency > 0 {
+		rxcuis.concurrency = cfg.RxNavConcurrency
+	}
+	if cfg.RxNavLookupTimeout > 0 {
+		rxcuis.timeout = cfg.RxNavLookupTimeout
+	}
+	rxcuis.retries = cfg.RxNavRetries
+	auth := newAuthChain(cfg)
+	authn := authenticate(auth)
+	clinician := requireRole(auth, roleClinician)
+	reviewer := requireRole(auth, roleReviewer)
+	reader := requireRole(auth, roleClinician, roleReviewer)
+	admin := requireRole(auth, roleAdmin)
+	limits := limitDiagnostics(
+		newRateLimiter(cfg.RateLimitLLM),
+		newRateLimiter(cfg.RateLimitRules),
+		newQuotaTracker(cfg.QuotaDailyTokens, cfg.QuotaDailyCostUSD, cfg.TokenPrices),
+	)
+
 	router := gin.New()
+	// Forwarded client addresses are only believed from configured proxies; otherwise any caller
+	// could pick its own rate-limit bucket with X-Forwarded-For.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("trusted proxies error: %v", err)
+		_ = router.SetTrustedProxies(nil)
+	}
 	router.Use(
 		gin.Logger(),
 		gin.Recovery(),
 		limitBodySize(1<<20), // 1MB max body
-		cors.New(cors.Config{
-			AllowOrigins: []string{"*"},
-			AllowMethods: []string{"GET", "POST", "OPTIONS"},
-			AllowHeaders: []string{"Origin", "Content-Type", "Authorization"},
-			MaxAge:       12 * time.Hour,
-		}),
+		securityHeaders(cfg.CSPConnectSrc),
+		corsMiddleware(cfg),
 	)
 
 	// Serve static frontend from repository root under /static and root index.
@@ -317,7 +587,7 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 
 	router.GET("/readyz", func(c *gin.Context) {
 		if db == nil {
-			c.JSON(http.StatusOK, gin.H{"status": "ok", "db": "disabled"})
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "db": "disabled", "providers": providers.breakerStatus()})
 			return
 		}
 
@@ -328,42 +598,32 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 		if err := db.Ping(ctx); err != nil {
 			dbStatus = fmt.Sprintf("unhealthy: %v", err)
 			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"status": "degraded",
-				"db":     dbStatus,
+				"status":    "degraded",
+				"db":        dbStatus,
+				"providers": providers.breakerStatus(),
 			})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"db":     dbStatus,
+			"status":    "ok",
+			"db":        dbStatus,
+			"providers": providers.breakerStatus(),
 		})
 	})
 
-	router.POST("/api/diagnostics/mock", func(c *gin.Context) {
-		var payload PatientData
-		if err := c.ShouldBindJSON(&payload); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+	router.POST("/api/diagnostics/:provider", authn, clinician, limits, func(c *gin.Context) {
+		name := strings.ToLower(c.Param("provider"))
+		provider, ok := providers.get(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown_provider", "provider": name})
 			return
 		}
-
-		if errs := validatePatientData(payload); len(errs) > 0 {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"error":  "validation_failed",
-				"issues": errs,
-			})
+		if !provider.Available() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": name + "_unavailable", "reason": "not_configured"})
 			return
 		}
 
-		result := mockAnalyze(payload)
-		c.JSON(http.StatusOK, result)
-	})
-
-	router.POST("/api/diagnostics/gemini", func(c *gin.Context) {
-		if cfg.GeminiAPIKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "gemini_unavailable", "reason": "missing_api_key"})
-			return
-		}
 		var payload PatientData
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
@@ -376,20 +636,48 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 			})
 			return
 		}
-		resp, err := proxyGemini(c.Request.Context(), cfg.GeminiAPIKey, payload)
+
+		requestedAt := time.Now()
+		rules := activeRules.Load()
+		result, used, err := providers.analyze(withRulePack(c.Request.Context(), rules), name, payload)
 		if err != nil {
-			log.Printf("gemini proxy error: %v", err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "gemini_proxy_failed", "details": err.Error()})
+			respondModelError(c, name, err)
 			return
 		}
-		c.JSON(http.StatusOK, resp)
+		if used != name && used != mockProviderName {
+			result.Model = used
+		}
+		assessment := newAssessment(name, used, rules, payload, result, requestedAt)
+		if result.AssessmentID, err = recordAssessment(c.Request.Context(), stores, assessment); err != nil {
+			log.Printf("assessment audit error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "audit_write_failed"})
+			return
+		}
+		if wantsExplain(c) {
+			result.Explain = explainRules(rules, payload)
+		}
+		c.JSON(http.StatusOK, result)
 	})
 
-	router.POST("/api/diagnostics/openai", func(c *gin.Context) {
-		if cfg.OpenAIAPIKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "openai_unavailable", "reason": "missing_api_key"})
+	router.POST("/api/diagnostics/hybrid", authn, clinician, limits, func(c *gin.Context) {
+		model := strings.ToLower(c.DefaultQuery("model", ""))
+		if model == "" {
+			model = providers.firstAvailableModel()
+			if model == "" {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "hybrid_unavailable", "reason": "no_model_configured"})
+				return
+			}
+		}
+		provider, ok := providers.get(model)
+		if !ok || model == mockProviderName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown_model", "model": model})
 			return
 		}
+		if !provider.Available() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": model + "_unavailable", "reason": "not_configured"})
+			return
+		}
+
 		var payload PatientData
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
@@ -402,50 +690,206 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 			})
 			return
 		}
-		resp, err := proxyOpenAI(c.Request.Context(), cfg.OpenAIAPIKey, payload)
-		if err != nil {
-			log.Printf("openai proxy error: %v", err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "openai_proxy_failed", "details": err.Error()})
+
+		requestedAt := time.Now()
+		rules := activeRules.Load()
+		rulesResult := evaluateRulePack(rules.Pack, payload)
+		modelResult, used, err := providers.analyze(withRulePack(c.Request.Context(), rules), model, payload)
+
+		result := rulesResult
+		if err != nil || used == mockProviderName {
+			// Every model failed; the rules result stands on its own.
+			if err != nil {
+				used = "rules"
+			}
+			result.Fallback = modelResult.Fallback
+			result.Redaction = modelResult.Redaction
+		} else {
+			result = mergeHybrid(rulesResult, modelResult)
+			result.Model = used
+			result.Fallback = modelResult.Fallback
+			result.Usage = modelResult.Usage
+			result.Redaction = modelResult.Redaction
+		}
+		assessment := newAssessment("hybrid", used, rules, payload, result, requestedAt)
+		if result.AssessmentID, err = recordAssessment(c.Request.Context(), stores, assessment); err != nil {
+			log.Printf("assessment audit error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "audit_write_failed"})
 			return
 		}
-		c.JSON(http.StatusOK, resp)
+		if wantsExplain(c) {
+			result.Explain = explainRules(rules, payload)
+		}
+		c.JSON(http.StatusOK, result)
 	})
 
 	router.GET("/api/config", func(c *gin.Context) {
 		// Determine a sensible default model: respect env override, else pick the first available.
 		envDefault := strings.ToLower(getEnv("DEFAULT_MODEL", ""))
-		modelAvailability := map[string]bool{
-			"mock":   true,
-			"gemini": cfg.GeminiAPIKey != "",
-			"openai": cfg.OpenAIAPIKey != "",
-		}
+		modelAvailability := providers.availability()
 
-		// Force OpenAI when available; allow explicit env override for non-mock values.
+		// Prefer the first available model provider; allow explicit env override for non-mock values.
 		defaultModel := ""
-		if envDefault != "" && envDefault != "mock" && modelAvailability[envDefault] {
+		if envDefault != "" && envDefault != mockProviderName && modelAvailability[envDefault] {
 			defaultModel = envDefault
 		}
-
 		if defaultModel == "" {
-			switch {
-			case modelAvailability["openai"]:
-				defaultModel = "openai"
-			case modelAvailability["gemini"]:
-				defaultModel = "gemini"
-			default:
-				defaultModel = "mock"
-			}
+			defaultModel = providers.firstAvailableModel()
+		}
+		if defaultModel == "" {
+			defaultModel = mockProviderName
 		}
 
 		cfgResp := map[string]any{
 			"defaultModel": defaultModel,
 			"models":       modelAvailability,
 			"llmProxy":     true,
+			"auth":         gin.H{"required": auth.enabled(), "methods": auth.methods()},
 		}
 		c.JSON(http.StatusOK, cfgResp)
 	})
 
-	router.POST("/api/interactions/check", func(c *gin.Context) {
+	router.GET("/api/assessments", authn, reader, func(c *gin.Context) {
+		if stores.assessments == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "assessments_unavailable", "reason": "db_disabled"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAssessmentPageSize)))
+		if err != nil || limit < 1 || limit > maxAssessmentPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limit", "details": fmt.Sprintf("limit must be between 1 and %d", maxAssessmentPageSize)})
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_offset", "details": "offset must be a non-negative integer"})
+			return
+		}
+
+		items, total, err := stores.assessments.List(c.Request.Context(), limit, offset)
+		if err != nil {
+			log.Printf("assessment list error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "assessments_query_failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"assessments": items, "total": total, "limit": limit, "offset": offset})
+	})
+
+	router.GET("/api/assessments/:id", authn, reader, func(c *gin.Context) {
+		if stores.assessments == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "assessments_unavailable", "reason": "db_disabled"})
+			return
+		}
+		a, err := stores.assessments.Get(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, errAssessmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "assessment_not_found"})
+			return
+		}
+		if err != nil {
+			log.Printf("assessment get error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "assessments_query_failed"})
+			return
+		}
+		c.JSON(http.StatusOK, a)
+	})
+
+	router.POST("/api/assessments/:id/review", authn, reviewer, func(c *gin.Context) {
+		if stores.assessments == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "assessments_unavailable", "reason": "db_disabled"})
+			return
+		}
+		var req ReviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+		// With auth on, reviews are signed by the caller; the body may only name the caller.
+		if p := principalFrom(c); p != nil {
+			if name := strings.TrimSpace(req.Reviewer); name != "" && name != p.Subject {
+				c.JSON(http.StatusForbidden, gin.H{"error": "reviewer_mismatch", "reviewer": name})
+				return
+			}
+			req.Reviewer = p.Subject
+		}
+		a, err := stores.assessments.Get(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, errAssessmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "assessment_not_found"})
+			return
+		}
+		if err != nil {
+			log.Printf("assessment get error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "assessments_query_failed"})
+			return
+		}
+
+		review, errs := newReview(a, req)
+		if len(errs) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "validation_failed",
+				"issues": errs,
+			})
+			return
+		}
+		if err := recordReview(c.Request.Context(), stores, review); err != nil {
+			log.Printf("assessment review error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "review_save_failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, review)
+	})
+
+	router.GET("/api/audit/verify", authn, admin, func(c *gin.Context) {
+		if stores.audit == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "audit_unavailable"})
+			return
+		}
+		var anchor *AuditAnchor
+		if raw := c.Query("seq"); raw != "" {
+			seq, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || seq < 1 || c.Query("hash") == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_anchor"})
+				return
+			}
+			anchor = &AuditAnchor{Seq: seq, Hash: c.Query("hash")}
+		}
+		verification, err := verifyAuditChain(c.Request.Context(), stores.audit, anchor)
+		if err != nil {
+			log.Printf("audit verify error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "audit_query_failed"})
+			return
+		}
+		status := http.StatusOK
+		if !verification.OK {
+			status = http.StatusConflict
+		}
+		c.JSON(status, verification)
+	})
+
+	router.GET("/api/rules", authn, admin, func(c *gin.Context) {
+		c.JSON(http.StatusOK, activeRules.Load())
+	})
+
+	router.GET("/api/metrics", authn, admin, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"rxnavCache": rxcuis.cache.stats()})
+	})
+
+	router.POST("/api/medications/parse", authn, clinician, func(c *gin.Context) {
+		var req struct {
+			Medications       string `json:"medications"`
+			MedicationDetails string `json:"medicationDetails"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+
+		meds := parsePatientMedications(req.Medications, req.MedicationDetails)
+		if meds == nil {
+			meds = []MedicationSig{}
+		}
+		c.JSON(http.StatusOK, gin.H{"medications": meds})
+	})
+
+	router.POST("/api/interactions/check", authn, clinician, func(c *gin.Context) {
 		var req struct {
 			Medications       string `json:"medications"`
 			MedicationDetails string `json:"medicationDetails"`
@@ -476,28 +920,36 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 12*time.Second)
 		defer cancel()
 
+		var consulted []string
+		var dbInteractions []Interaction
 		if dbPool != nil {
-			dbInteractions, warning, err := lookupInteractionsDB(ctx, dbPool, meds)
+			found, warning, err := lookupInteractionsDB(ctx, dbPool, meds)
 			if len(warning) > 0 {
 				resp.Warnings = append(resp.Warnings, warning)
 			}
 			if err != nil {
 				resp.Warnings = append(resp.Warnings, fmt.Sprintf("db_lookup_failed: %v", err))
-			} else if len(dbInteractions) > 0 {
-				resp.Interactions = append(resp.Interactions, dbInteractions...)
-				resp.Source = "db"
+			} else if warning == "" {
+				dbInteractions = withSource(found, interactionSourceDB)
+				consulted = append(consulted, interactionSourceDB)
 			}
 		}
 
-		if resp.Source == "" {
-			rxInteractions, resolved, unresolved, warnings := lookupInteractionsRxNav(ctx, meds)
-			resp.Interactions = append(resp.Interactions, rxInteractions...)
-			resp.Resolved = resolved
-			resp.Unresolved = unresolved
-			resp.Warnings = append(resp.Warnings, warnings...)
-			resp.Source = "rxnav"
+		var rxInteractions []Interaction
+		if cfg.InteractionMode != interactionModeFirst || len(dbInteractions) == 0 {
+			rx := lookupInteractionsRxNav(ctx, rxcuis, meds)
+			rxInteractions = withSource(rx.Interactions, interactionSourceRxNav)
+			resp.Resolved = rx.Resolved
+			resp.Unresolved = rx.Unresolved
+			resp.Matches = rx.Matches
+			resp.Warnings = append(resp.Warnings, rx.Warnings...)
+			consulted = append(consulted, interactionSourceRxNav)
+		} else {
+			consulted = []string{interactionSourceDB}
 		}
 
+		resp.Interactions = mergeInteractions(dbInteractions, rxInteractions)
+		resp.Source = strings.Join(consulted, "+")
 		if resp.Source == "" {
 			resp.Source = "none"
 		}
@@ -508,113 +960,27 @@ func setupRouter(db HealthChecker, dbPool *pgxpool.Pool, staticRoot string, cfg
 	return router
 }
 
-func proxyGemini(ctx context.Context, apiKey string, data PatientData) (map[string]any, error) {
-	bodyBytes, err := json.Marshal(map[string]any{
-		"contents": []map[string]any{
-			{"parts": []map[string]string{{"text": fmt.Sprintf("Patient Data: %s", toJSON(data))}}},
-		},
-		"systemInstruction": map[string]any{
-			"parts": []map[string]string{{"text": systemPrompt}},
-		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash-preview-09-2025:generateContent?key=%s", apiKey), bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return nil, fmt.Errorf("build request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("call gemini: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("gemini status %d", resp.StatusCode)
-	}
-
-	var parsed struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, fmt.Errorf("decode gemini response: %w", err)
-	}
-	if len(parsed.Candidates) == 0 || len(parsed.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("gemini response missing content")
-	}
-	rawText := cleanupJSONText(parsed.Candidates[0].Content.Parts[0].Text)
-	var out map[string]any
-	if err := json.Unmarshal([]byte(rawText), &out); err != nil {
-		return nil, fmt.Errorf("unmarshal gemini payload: %w", err)
-	}
-	return out, nil
+// wantsExplain reports whether the request asked for the rule evaluation trace (?explain=true).
+// The trace is returned to the caller only; the stored assessment keeps the plain result.
+func wantsExplain(c *gin.Context) bool {
+	explain, _ := strconv.ParseBool(c.Query("explain"))
+	return explain
 }
 
-func proxyOpenAI(ctx context.Context, apiKey string, data PatientData) (map[string]any, error) {
-	bodyBytes, err := json.Marshal(map[string]any{
-		"model": "gpt-4o",
-		"messages": []map[string]string{
-			{"role": "system", "content": systemPrompt},
-			{"role": "user", "content": toJSON(data)},
-		},
-		"response_format": map[string]string{"type": "json_object"},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+// respondModelError writes a 502 for a failed model call, listing schema violations when the
+// model answered but its output could not be repaired.
+func respondModelError(c *gin.Context, model string, err error) {
+	var schemaErr *modelSchemaError
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": model + "_unavailable", "reason": "circuit_open"})
+		return
 	}
-
-	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return nil, fmt.Errorf("build request: %w", err)
+	if errors.As(err, &schemaErr) {
+		c.JSON(http.StatusBadGateway, gin.H{"error": model + "_schema_invalid", "violations": schemaErr.Violations})
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("call openai: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("openai status %d", resp.StatusCode)
-	}
-
-	var parsed struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, fmt.Errorf("decode openai response: %w", err)
-	}
-	if len(parsed.Choices) == 0 {
-		return nil, fmt.Errorf("openai response missing choices")
-	}
-	rawText := cleanupJSONText(parsed.Choices[0].Message.Content)
-	var out map[string]any
-	if err := json.Unmarshal([]byte(rawText), &out); err != nil {
-		return nil, fmt.Errorf("unmarshal openai payload: %w", err)
-	}
-	return out, nil
+	c.JSON(http.StatusBadGateway, gin.H{"error": model + "_proxy_failed", "details": failureReason(err)})
 }
 
 func cleanupJSONText(s string) string {
@@ -657,84 +1023,87 @@ func normalizeMedList(meds, details string) []string {
 	return out
 }
 
+// lookupInteractionsDB finds interactions between meds in the local knowledge base
+// (migrations/0006_drug_interactions.sql). Each medication is looked up as entered and as its
+// active ingredients, so "Viagra", "sildenafil citrate 50mg" and combination products find the
+// ingredient rows. Class-level rows (migrations/0008_class_interactions.sql) match through the
+// drug-class registry. Each interaction lists the entries that matched it under Medications.
 func lookupInteractionsDB(ctx context.Context, db *pgxpool.Pool, meds []string) ([]Interaction, string, error) {
+	terms := newInteractionTerms(meds)
 	rows, err := db.Query(ctx, `
-		select drug_a, drug_b, severity, note
+		select id, kind_a, drug_a, kind_b, drug_b, severity, note, refs
 		from drug_interactions
-		where drug_a = any($1) and drug_b = any($1)
-	`, meds)
+		where ((kind_a = 'drug' and drug_a = any($1)) or (kind_a = 'class' and drug_a = any($2)))
+		  and ((kind_b = 'drug' and drug_b = any($1)) or (kind_b = 'class' and drug_b = any($2)))
+	`, terms.drugNames(), terms.classNames())
 	if err != nil {
 		if strings.Contains(err.Error(), "does not exist") {
-			// Table not provisioned yet; treat as no data without warning noise.
-			return nil, "", nil
+			// Table (or the class columns) not provisioned yet; say so rather than report a clean result.
+			return nil, "db_table_missing: drug_interactions (run migrations and go run ./cmd/import -seed)", nil
 		}
 		return nil, "", err
 	}
 	defer rows.Close()
 
-	dedup := make(map[string]Interaction)
+	var found []interactionRow
 	for rows.Next() {
-		var drugA, drugB, severity, note string
-		if err := rows.Scan(&drugA, &drugB, &severity, &note); err != nil {
+		var row interactionRow
+		if err := rows.Scan(&row.id, &row.kindA, &row.drugA, &row.kindB, &row.drugB, &row.severity, &row.note, &row.refs); err != nil {
 			return nil, "", err
 		}
-		drugA = strings.TrimSpace(drugA)
-		drugB = strings.TrimSpace(drugB)
-		sev := strings.ToUpper(strings.TrimSpace(severity))
-		if sev != "HIGH" && sev != "MEDIUM" && sev != "LOW" {
-			sev = "MEDIUM"
-		}
-
-		keyParts := []string{strings.ToLower(drugA), strings.ToLower(drugB)}
-		sort.Strings(keyParts)
-		key := strings.Join(keyParts, "|")
-		dedup[key] = Interaction{
-			Pair:     fmt.Sprintf("%s + %s", drugA, drugB),
-			Severity: sev,
-			Note:     note,
-		}
+		found = append(found, row)
 	}
-
-	var interactions []Interaction
-	for _, v := range dedup {
-		interactions = append(interactions, v)
+	if err := rows.Err(); err != nil {
+		return nil, "", err
 	}
-	return interactions, "", nil
+	return terms.interactions(found), "", nil
 }
 
-func lookupInteractionsRxNav(ctx context.Context, meds []string) ([]Interaction, []string, []string, []string) {
-	var resolved []string
-	var unresolved []string
+// lookupInteractionsRxNav resolves meds to RXCUIs and fetches their interactions from RxNav. When
+// the resolver is offline the interaction list is not fetched.
+func lookupInteractionsRxNav(ctx context.Context, resolver *rxcuiResolver, meds []string) InteractionCheckResponse {
+	out := InteractionCheckResponse{Interactions: []Interaction{}, Resolved: []string{}, Unresolved: []string{}, Warnings: []string{}}
 	var rxcuis []string
 
-	for _, med := range meds {
-		rxcui, err := resolveRXCUI(ctx, med)
-		if err != nil {
-			unresolved = append(unresolved, med)
-			continue
+	for i, lookup := range resolver.resolveAll(ctx, meds) {
+		med, match := meds[i], lookup.match
+		if lookup.err != nil {
+			out.Warnings = append(out.Warnings, lookupWarning(med, lookup.err))
 		}
-		if rxcui == "" {
-			unresolved = append(unresolved, med)
+		if lookup.err != nil || match.RXCUI == "" {
+			out.Unresolved = append(out.Unresolved, med)
 			continue
 		}
-		resolved = append(resolved, med)
-		rxcuis = append(rxcuis, rxcui)
+		out.Resolved = append(out.Resolved, med)
+		out.Matches = append(out.Matches, match)
+		if !containsString(rxcuis, match.RXCUI) {
+			rxcuis = append(rxcuis, match.RXCUI)
+		}
 	}
 
 	if len(rxcuis) < 2 {
 		warning := "not_enough_rxcui_matches"
-		if len(resolved) == 0 {
+		if len(out.Resolved) == 0 {
 			warning = "no_rxcui_matches"
 		}
-		return []Interaction{}, resolved, unresolved, []string{warning}
+		out.Warnings = append(out.Warnings, warning)
+		return out
+	}
+	if !resolver.network {
+		out.Warnings = append(out.Warnings, "rxnav_offline: interaction list not fetched")
+		return out
 	}
 
-	interactions, warnings := fetchRxNavInteractions(ctx, rxcuis)
-	return interactions, resolved, unresolved, warnings
+	interactions, err := resolver.interactions(ctx, rxcuis)
+	if err != nil {
+		out.Warnings = append(out.Warnings, err.Error())
+	}
+	out.Interactions = append(out.Interactions, interactions...)
+	return out
 }
 
 func resolveRXCUI(ctx context.Context, med string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://rxnav.nlm.nih.gov/REST/rxcui.json?name=%s", url.QueryEscape(med)), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/rxcui.json?name=%s", rxnavBaseURL, url.QueryEscape(med)), nil)
 	if err != nil {
 		return "", err
 	}
@@ -743,6 +1112,9 @@ func resolveRXCUI(ctx context.Context, med string) (string, error) {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &rxnavStatusError{code: resp.StatusCode}
+	}
 
 	var parsed struct {
 		IDGroup struct {
@@ -758,23 +1130,23 @@ func resolveRXCUI(ctx context.Context, med string) (string, error) {
 	return parsed.IDGroup.RxNormID[0], nil
 }
 
-func fetchRxNavInteractions(ctx context.Context, rxcuis []string) ([]Interaction, []string) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://rxnav.nlm.nih.gov/REST/interaction/list.json?rxcuis=%s", url.QueryEscape(strings.Join(rxcuis, "+"))), nil)
+func fetchRxNavInteractions(ctx context.Context, rxcuis []string) ([]Interaction, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/interaction/list.json?rxcuis=%s", rxnavBaseURL, url.QueryEscape(strings.Join(rxcuis, "+"))), nil)
 	if err != nil {
-		return nil, []string{fmt.Sprintf("rxnav_request_build_failed: %v", err)}
+		return nil, fmt.Errorf("rxnav_request_build_failed: %w", err)
 	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, []string{fmt.Sprintf("rxnav_request_failed: %v", err)}
+		return nil, fmt.Errorf("rxnav_request_failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
 		// Treat 404 as "no interactions found" without noisy warnings.
-		return []Interaction{}, []string{}
+		return []Interaction{}, nil
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, []string{fmt.Sprintf("rxnav_status_%d", resp.StatusCode)}
+		return nil, &rxnavStatusError{code: resp.StatusCode}
 	}
 
 	var parsed struct {
@@ -794,7 +1166,7 @@ func fetchRxNavInteractions(ctx context.Context, rxcuis []string) ([]Interaction
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, []string{fmt.Sprintf("rxnav_decode_failed: %v", err)}
+		return nil, fmt.Errorf("rxnav_decode_failed: %w", err)
 	}
 
 	dedup := make(map[string]Interaction)
@@ -826,7 +1198,7 @@ func fetchRxNavInteractions(ctx context.Context, rxcuis []string) ([]Interaction
 	for _, v := range dedup {
 		interactions = append(interactions, v)
 	}
-	return interactions, []string{}
+	return interactions, nil
 }
 
 func mapRxSeverity(raw string) string {
@@ -847,201 +1219,70 @@ func mockAnalyze(data PatientData) DiagnosticResult {
 }
 
 func runSafetyEngine(data PatientData) DiagnosticResult {
-	meds := normalizeList(data.Medications)
-	allergies := normalizeList(data.Allergies)
-
-	conditions := make([]string, 0, len(data.Conditions))
-	for _, c := range data.Conditions {
-		conditions = append(conditions, strings.ToLower(strings.TrimSpace(c)))
-	}
-
-	hasPDE5i := hasClassToken(meds, pde5iClass)
-	hasNitrates := hasClassToken(meds, nitrateClass)
-	hasAlphaBlocker := hasClassToken(meds, alphaBlockerClass)
-	hasCyp3a4 := hasClassToken(meds, cyp3a4Class)
-	bpSys := data.BPSystolic
-	bpDia := data.BPDiastolic
-	bmi := data.BMI
-	smoking := strings.ToLower(strings.TrimSpace(data.Smoking))
-	alcohol := strings.ToLower(strings.TrimSpace(data.Alcohol))
-	exercise := strings.ToLower(strings.TrimSpace(data.Exercise))
-
-	pregnant := containsString(conditions, "pregnant")
-	kidneyDisease := containsString(conditions, "kidney disease")
-	liverDisease := containsString(conditions, "liver disease")
-	heartDisease := containsString(conditions, "heart disease")
-	hypertension := containsString(conditions, "hypertension")
-
-	allergyToPde5i := hasClassToken(allergies, pde5iClass)
-	allergyToNitrates := hasClassToken(allergies, nitrateClass)
+	return evaluateRulePack(currentRulePack(), data)
+}
+
+func evaluateRulePack(pack *RulePack, data PatientData) DiagnosticResult {
+	facts := newPatientFacts(data)
 
 	interactions := []Interaction{}
 	contraindications := []Contraindication{}
 	dosingConcerns := []DosingConcern{}
+	reduceDose := false
+	rationaleParts := []string{}
 
-	if hasPDE5i && hasNitrates {
-		interactions = append(interactions, Interaction{
-			Pair:     "Nitrates + PDE5i",
-			Severity: "HIGH",
-			Note:     "Risk of profound hypotension; avoid co-administration.",
-		})
-	}
-	if hasPDE5i && hasAlphaBlocker {
-		interactions = append(interactions, Interaction{
-			Pair:     "Alpha-blocker + PDE5i",
-			Severity: "MEDIUM",
-			Note:     "Additive hypotension; separate dosing and start low.",
-		})
-	}
-	if hasPDE5i && hasCyp3a4 {
-		interactions = append(interactions, Interaction{
-			Pair:     "Strong CYP3A4 inhibitor + PDE5i",
-			Severity: "MEDIUM",
-			Note:     "Higher PDE5i levels; use lowest dose and monitor.",
-		})
-	}
-
-	for _, rule := range ruleDB {
+	for i, trace := range pack.evaluate(facts) {
+		if !trace.Fired {
+			continue
+		}
+		rule := pack.Rules[i]
 		switch rule.Type {
 		case "interaction":
-			if hasClassTokenByName(meds, rule.Match.DrugClassA) && hasClassTokenByName(meds, rule.Match.DrugClassB) {
-				interactions = append(interactions, Interaction{
-					Pair:     fmt.Sprintf("%s+%s", rule.Match.DrugClassA, rule.Match.DrugClassB),
-					Severity: rule.Severity,
-					Note:     rule.Note,
-				})
-			}
+			interactions = append(interactions, Interaction{
+				Pair:      rule.label(),
+				Severity:  rule.Severity,
+				Note:      rule.Note,
+				RuleID:    rule.ID,
+				MatchedOn: trace.MatchedOn,
+				Evidence:  rule.References,
+			})
 		case "contra":
-			condMatch := rule.Match.Condition != "" && containsString(conditions, rule.Match.Condition)
-			drugMatch := rule.Match.RequiresDrugClass == "" || hasClassTokenByName(meds, rule.Match.RequiresDrugClass)
-			if condMatch && drugMatch {
-				contraindications = append(contraindications, Contraindication{
-					ConditionOrAllergy: rule.Match.Condition,
-					Severity:           rule.Severity,
-					Note:               rule.Note,
-				})
-			}
+			contraindications = append(contraindications, Contraindication{
+				ConditionOrAllergy: rule.label(),
+				Severity:           rule.Severity,
+				Note:               rule.Note,
+				RuleID:             rule.ID,
+				MatchedOn:          trace.MatchedOn,
+				Evidence:           rule.References,
+			})
 		case "dosing":
-			if rule.Match.Condition != "" && containsString(conditions, rule.Match.Condition) {
-				dosingConcerns = append(dosingConcerns, DosingConcern{
-					Factor:         rule.Match.Condition,
-					Severity:       rule.Severity,
-					Recommendation: rule.Note,
-				})
+			concern := DosingConcern{
+				Factor:         rule.label(),
+				Severity:       rule.Severity,
+				Recommendation: rule.Note,
+				RuleID:         rule.ID,
+				MatchedOn:      trace.MatchedOn,
+				Evidence:       rule.References,
+			}
+			if rule.Match.MaxDoseMg > 0 {
+				if sig, mg, ok := facts.dosedAbove(rule.Match.Drug, rule.Match.MaxDoseMg); ok {
+					concern.ObservedDose = fmt.Sprintf("%s %smg", sig.Generic, formatMg(mg))
+					if sig.dosesPerDay() > 1 {
+						strength, _ := sig.doseMg()
+						concern.ObservedDose = fmt.Sprintf("%s %smg/day (%smg %s)", sig.Generic, formatMg(mg), formatMg(strength), sig.Frequency)
+					}
+					concern.MaxDose = fmt.Sprintf("%s %smg", sig.Generic, formatMg(rule.Match.MaxDoseMg))
+					concern.Recommendation = fmt.Sprintf("%s Observed %s; max %s.", rule.Note, concern.ObservedDose, concern.MaxDose)
+				}
 			}
+			dosingConcerns = append(dosingConcerns, concern)
+		}
+		if rule.ReduceDose {
+			reduceDose = true
+		}
+		if rule.Rationale != "" {
+			rationaleParts = append(rationaleParts, rule.Rationale)
 		}
-	}
-
-	if hasNitrates {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Nitrate therapy",
-			Severity:           "HIGH",
-			Note:               "Concurrent nitrate use contraindicates PDE5 inhibitors due to hypotension risk.",
-		})
-	}
-	if bpSys >= 170 || bpDia >= 110 {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Severely elevated BP",
-			Severity:           "HIGH",
-			Note:               "Uncontrolled hypertension; PDE5 inhibitors contraindicated.",
-		})
-	} else if bpSys >= 150 || bpDia >= 95 {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Elevated BP",
-			Severity:           "MEDIUM",
-			Note:               "Elevated blood pressure; use lowest dose and monitor.",
-		})
-	}
-	if allergyToPde5i {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "PDE5 inhibitor allergy",
-			Severity:           "HIGH",
-			Note:               "Do not prescribe PDE5 inhibitors.",
-		})
-	}
-	if allergyToNitrates {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Nitrate allergy",
-			Severity:           "HIGH",
-			Note:               "Avoid nitrates and PDE5 co-prescribing.",
-		})
-	}
-	if pregnant {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Pregnancy",
-			Severity:           "MEDIUM",
-			Note:               "Safety not established; avoid PDE5 inhibitors.",
-		})
-	}
-	if heartDisease {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Heart Disease",
-			Severity:           "MEDIUM",
-			Note:               "Assess hemodynamic reserve; prefer low dose or alternative.",
-		})
-	}
-	if hypertension {
-		contraindications = append(contraindications, Contraindication{
-			ConditionOrAllergy: "Hypertension",
-			Severity:           "MEDIUM",
-			Note:               "Monitor BP; start low to avoid hypotension.",
-		})
-	}
-
-	if data.Age >= 65 {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Age >65",
-			Severity:       "MEDIUM",
-			Recommendation: "Initiate at lowest dose; titrate cautiously.",
-		})
-	}
-	if kidneyDisease {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Renal impairment",
-			Severity:       "MEDIUM",
-			Recommendation: "Max 2.5mg-5mg daily; monitor for hypotension.",
-		})
-	}
-	if liverDisease {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Hepatic impairment",
-			Severity:       "MEDIUM",
-			Recommendation: "Use lowest dose; consider avoiding if severe.",
-		})
-	}
-	if bmi >= 35 {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Obesity (BMI ≥35)",
-			Severity:       "MEDIUM",
-			Recommendation: "Start lowest dose; monitor cardiovascular tolerance.",
-		})
-	} else if bmi >= 30 {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Overweight (BMI ≥30)",
-			Severity:       "LOW",
-			Recommendation: "Start low; encourage weight management and monitoring.",
-		})
-	}
-	if smoking == "current" {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Smoking",
-			Severity:       "LOW",
-			Recommendation: "Counsel cessation; monitor CV risk with therapy.",
-		})
-	}
-	if alcohol == "heavy" {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Heavy alcohol use",
-			Severity:       "MEDIUM",
-			Recommendation: "Avoid concurrent dosing; monitor BP and sedation risk.",
-		})
-	}
-	if exercise == "none" {
-		dosingConcerns = append(dosingConcerns, DosingConcern{
-			Factor:         "Sedentary",
-			Severity:       "LOW",
-			Recommendation: "Encourage activity; monitor cardiometabolic risk.",
-		})
 	}
 
 	allFindings := len(interactions) + len(contraindications) + len(dosingConcerns)
@@ -1068,6 +1309,10 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 	}
 	if maxSeverity != "HIGH" {
 		for _, d := range dosingConcerns {
+			if d.Severity == "HIGH" {
+				maxSeverity = "HIGH"
+				break
+			}
 			if d.Severity == "MEDIUM" && maxSeverity == "LOW" {
 				maxSeverity = "MEDIUM"
 			}
@@ -1076,13 +1321,13 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 
 	score := 5
 	for _, i := range interactions {
-		score += severityWeight[i.Severity]
+		score += pack.SeverityWeight[i.Severity]
 	}
 	for _, c := range contraindications {
-		score += severityWeight[c.Severity]
+		score += pack.SeverityWeight[c.Severity]
 	}
 	for _, d := range dosingConcerns {
-		score += severityWeight[d.Severity]
+		score += pack.SeverityWeight[d.Severity]
 	}
 	if score > 100 {
 		score = 100
@@ -1095,19 +1340,7 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 		riskLevel = "MEDIUM"
 	}
 
-	issues := []string{}
-	for _, i := range interactions {
-		issues = append(issues, fmt.Sprintf("[%s] Interaction: %s - %s", i.Severity, i.Pair, i.Note))
-	}
-	for _, c := range contraindications {
-		issues = append(issues, fmt.Sprintf("[%s] Contraindication: %s - %s", c.Severity, c.ConditionOrAllergy, c.Note))
-	}
-	for _, d := range dosingConcerns {
-		issues = append(issues, fmt.Sprintf("[%s] Dosing: %s - %s", d.Severity, d.Factor, d.Recommendation))
-	}
-	if len(issues) == 0 {
-		issues = append(issues, "None")
-	}
+	issues := buildIssues(interactions, contraindications, dosingConcerns)
 
 	medication := "Tadalafil"
 	dosage := "5mg Daily"
@@ -1118,38 +1351,16 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 		medication = "None"
 		dosage = "N/A"
 		duration = "N/A"
-	} else if data.Age >= 65 || kidneyDisease || liverDisease || hasAlphaBlocker || hasCyp3a4 || hypertension || heartDisease {
+	} else if reduceDose {
 		dosage = "2.5mg Daily"
 		duration = "30 Days"
 	}
 
-	rationaleParts := []string{}
+	summary := "PDE5 inhibitor indicated; starting conservatively due to risk factors."
 	if medication == "None" {
-		rationaleParts = append(rationaleParts, "Safety blockers present; pharmacotherapy deferred.")
-	} else {
-		rationaleParts = append(rationaleParts, "PDE5 inhibitor indicated; starting conservatively due to risk factors.")
-	}
-	if data.Age >= 65 {
-		rationaleParts = append(rationaleParts, "Age >65")
-	}
-	if kidneyDisease {
-		rationaleParts = append(rationaleParts, "Renal impairment")
-	}
-	if liverDisease {
-		rationaleParts = append(rationaleParts, "Hepatic impairment")
-	}
-	if hasAlphaBlocker {
-		rationaleParts = append(rationaleParts, "Alpha-blocker co-therapy")
-	}
-	if hasCyp3a4 {
-		rationaleParts = append(rationaleParts, "CYP3A4 inhibitor present")
-	}
-	if heartDisease {
-		rationaleParts = append(rationaleParts, "Cardiovascular history")
-	}
-	if pregnant {
-		rationaleParts = append(rationaleParts, "Pregnancy")
+		summary = "Safety blockers present; pharmacotherapy deferred."
 	}
+	rationaleParts = append([]string{summary}, rationaleParts...)
 
 	confidence := 1 - float64(score)/120
 	if confidence < 0.6 {
@@ -1187,6 +1398,7 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 		ConfidenceScore:          confidence,
 		RecommendationConfidence: RecommendationConfidence{Plan: planConfidence},
 		Source:                   "rules",
+		doseReduced:              reduceDose && !highBlocker,
 	}
 
 	if allFindings == 0 {
@@ -1197,6 +1409,23 @@ func runSafetyEngine(data PatientData) DiagnosticResult {
 	return result
 }
 
+func buildIssues(interactions []Interaction, contraindications []Contraindication, dosingConcerns []DosingConcern) []string {
+	issues := []string{}
+	for _, i := range interactions {
+		issues = append(issues, fmt.Sprintf("[%s] Interaction: %s - %s", i.Severity, i.Pair, i.Note))
+	}
+	for _, c := range contraindications {
+		issues = append(issues, fmt.Sprintf("[%s] Contraindication: %s - %s", c.Severity, c.ConditionOrAllergy, c.Note))
+	}
+	for _, d := range dosingConcerns {
+		issues = append(issues, fmt.Sprintf("[%s] Dosing: %s - %s", d.Severity, d.Factor, d.Recommendation))
+	}
+	if len(issues) == 0 {
+		issues = append(issues, "None")
+	}
+	return issues
+}
+
 func normalizeList(text string) []string {
 	out := []string{}
 	for _, t := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
@@ -1210,30 +1439,14 @@ func normalizeList(text string) []string {
 	return out
 }
 
-func hasClassToken(tokens []string, class []string) bool {
-	for _, t := range tokens {
-		for _, drug := range class {
-			if strings.Contains(t, drug) {
-				return true
-			}
-		}
-	}
-	return false
+// hasClassTokenByName reports whether any token names a member of the class in the drug class registry.
+func hasClassTokenByName(tokens []string, className string) bool {
+	_, _, ok := drugClasses.Load().match(tokens, className)
+	return ok
 }
 
-func hasClassTokenByName(tokens []string, className string) bool {
-	switch className {
-	case "pde5i":
-		return hasClassToken(tokens, pde5iClass)
-	case "nitrates":
-		return hasClassToken(tokens, nitrateClass)
-	case "alphaBlockers":
-		return hasClassToken(tokens, alphaBlockerClass)
-	case "cyp3a4Inhibitors":
-		return hasClassToken(tokens, cyp3a4Class)
-	default:
-		return false
-	}
+func knownDrugClass(className string) bool {
+	return drugClasses.Load().has(className)
 }
 
 func containsString(values []string, target string) bool {
@@ -1263,6 +1476,15 @@ func hasSeverityContra(items []Contraindication, severity string) bool {
 	return false
 }
 
+func hasSeverityDosing(items []DosingConcern, severity string) bool {
+	for _, i := range items {
+		if i.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
 func validatePatientData(p PatientData) []validationError {
 	var errs []validationError
 
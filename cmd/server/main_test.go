@@ -77,6 +77,15 @@ func TestLoadConfigUsesDefaults(t *testing.T) {
 	}
 }
 
+func TestLoadConfigRejectsUnpricedCostQuota(t *testing.T) {
+	t.Setenv("ENABLE_DB", "false")
+	t.Setenv("QUOTA_DAILY_COST_USD", "5")
+	t.Setenv("LLM_PRICE_PER_1K_TOKENS", "")
+	if _, err := loadConfig(); err == nil {
+		t.Fatal("expected error for a cost quota without prices")
+	}
+}
+
 func TestRouterHealthz(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := setupRouter(fakeDB{}, nil, ".", &Config{})
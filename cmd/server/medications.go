@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MedicationSig is one medication entry parsed from free text (e.g. "tadalafil 5mg PO daily").
+type MedicationSig struct {
+	Raw       string   `json:"raw"`
+	Name      string   `json:"name"`
+	Generic   string   `json:"generic,omitempty"`
+	Classes   []string `json:"classes,omitempty"`
+	Dose      float64  `json:"dose,omitempty"`
+	Unit      string   `json:"unit,omitempty"`
+	Route     string   `json:"route,omitempty"`
+	Frequency string   `json:"frequency,omitempty"`
+	PRN       bool     `json:"prn"`
+}
+
+var (
+	doseRe      = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(mg|mcg|µg|ug|g|ml|units?|iu)\b`)
+	everyHourRe = regexp.MustCompile(`\bq\s?(\d{1,2})\s?h(?:rs?|ours?)?\b|\bevery (\d{1,2}) hours?\b`)
+
+	unitAliases = map[string]string{
+		"mg": "mg", "mcg": "mcg", "µg": "mcg", "ug": "mcg", "g": "g", "ml": "ml",
+		"unit": "units", "units": "units", "iu": "units",
+	}
+
+	// Phrases are matched on whole words against the lowercased entry. For routes the first hit in
+	// list order wins; for frequencies the longest hit wins, so "twice daily" is not read as "daily".
+	routePhrases = []struct{ phrase, route string }{
+		{"by mouth", "oral"}, {"po", "oral"}, {"oral", "oral"}, {"orally", "oral"}, {"tab", "oral"}, {"tablet", "oral"},
+		{"sublingual", "sublingual"}, {"sl", "sublingual"},
+		{"iv", "intravenous"}, {"intravenous", "intravenous"},
+		{"im", "intramuscular"}, {"intramuscular", "intramuscular"},
+		{"sc", "subcutaneous"}, {"subq", "subcutaneous"}, {"subcut", "subcutaneous"}, {"subcutaneous", "subcutaneous"},
+		{"transdermal", "transdermal"}, {"patch", "transdermal"},
+		{"topical", "topical"},
+		{"inhaled", "inhalation"}, {"inh", "inhalation"},
+	}
+	frequencyPhrases = []struct{ phrase, frequency string }{
+		{"once daily", "daily"}, {"once a day", "daily"}, {"every day", "daily"}, {"daily", "daily"}, {"qd", "daily"}, {"od", "daily"},
+		{"twice daily", "twice daily"}, {"twice a day", "twice daily"}, {"bid", "twice daily"},
+		{"three times daily", "three times daily"}, {"tid", "three times daily"},
+		{"four times daily", "four times daily"}, {"qid", "four times daily"},
+		{"at bedtime", "at bedtime"}, {"nightly", "at bedtime"}, {"qhs", "at bedtime"},
+		{"in the morning", "every morning"}, {"qam", "every morning"},
+		{"weekly", "weekly"}, {"once weekly", "weekly"},
+		{"on demand", "as needed"},
+	}
+	prnPhrases = []string{"prn", "as needed", "when needed", "on demand"}
+
+	// placeholder values the intake form writes for blank medication rows.
+	sigPlaceholders = []string{"unknown med", "unknown dose", "unknown freq"}
+)
+
+// parseMedications splits free text into entries and parses each into a MedicationSig.
+func parseMedications(text string) []MedicationSig {
+	var out []MedicationSig
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\n' || r == '\r'
+	}) {
+		if sig, ok := parseMedicationSig(entry); ok {
+			out = append(out, sig)
+		}
+	}
+	return out
+}
+
+// parsePatientMedications merges the medications and medicationDetails fields, preferring the
+// entry that carries dosing information when the same drug appears in both.
+func parsePatientMedications(meds, details string) []MedicationSig {
+	var out []MedicationSig
+	index := make(map[string]int)
+	for _, sig := range append(parseMedications(meds), parseMedications(details)...) {
+		key := sig.Name
+		if sig.Generic != "" {
+			key = sig.Generic
+		}
+		if i, seen := index[key]; seen {
+			if out[i].Dose == 0 && sig.Dose > 0 {
+				out[i] = sig
+			}
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, sig)
+	}
+	return out
+}
+
+// parseMedicationSig extracts drug, strength, unit, route and frequency from a single entry.
+func parseMedicationSig(entry string) (MedicationSig, bool) {
+	raw := strings.TrimSpace(entry)
+	text := strings.ToLower(strings.ReplaceAll(raw, "|", " "))
+	for _, p := range sigPlaceholders {
+		text = strings.ReplaceAll(text, p, " ")
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return MedicationSig{}, false
+	}
+
+	sig := MedicationSig{Raw: raw}
+	nameEnd := len(text)
+	mark := func(idx int) {
+		if idx >= 0 && idx < nameEnd {
+			nameEnd = idx
+		}
+	}
+
+	if m := doseRe.FindStringSubmatchIndex(text); m != nil {
+		sig.Dose, _ = strconv.ParseFloat(text[m[2]:m[3]], 64)
+		sig.Unit = unitAliases[text[m[4]:m[5]]]
+		mark(m[0])
+	}
+	for _, p := range routePhrases {
+		if idx := wordIndex(text, p.phrase); idx >= 0 {
+			sig.Route = p.route
+			mark(idx)
+			break
+		}
+	}
+	for _, p := range prnPhrases {
+		if idx := wordIndex(text, p); idx >= 0 {
+			sig.PRN = true
+			mark(idx)
+		}
+	}
+	if m := everyHourRe.FindStringSubmatchIndex(text); m != nil {
+		hours := text[m[2]:m[3]]
+		if hours == "" {
+			hours = text[m[4]:m[5]]
+		}
+		sig.Frequency = "every " + hours + " hours"
+		mark(m[0])
+	} else {
+		best, bestIdx := "", -1
+		for _, p := range frequencyPhrases {
+			if idx := wordIndex(text, p.phrase); idx >= 0 && len(p.phrase) > len(best) {
+				best, bestIdx = p.phrase, idx
+				sig.Frequency = p.frequency
+			}
+		}
+		mark(bestIdx)
+	}
+
+	sig.Name = strings.TrimSpace(text[:nameEnd])
+	if sig.Name == "" {
+		sig.Name = text
+	}
+	sig.Generic, sig.Classes = drugClasses.Load().resolve(sig.Name)
+	return sig, true
+}
+
+// doseMg converts the parsed strength to milligrams; ok is false for non-mass units.
+func (s MedicationSig) doseMg() (float64, bool) {
+	switch s.Unit {
+	case "mg":
+		return s.Dose, s.Dose > 0
+	case "g":
+		return s.Dose * 1000, s.Dose > 0
+	case "mcg":
+		return s.Dose / 1000, s.Dose > 0
+	default:
+		return 0, false
+	}
+}
+
+// dosesPerDay is how many doses the sig's frequency implies on a dosing day. Entries without a
+// frequency, as-needed entries and weekly entries count as one dose.
+func (s MedicationSig) dosesPerDay() float64 {
+	switch s.Frequency {
+	case "twice daily":
+		return 2
+	case "three times daily":
+		return 3
+	case "four times daily":
+		return 4
+	}
+	if m := everyHourRe.FindStringSubmatch(s.Frequency); m != nil {
+		if hours, _ := strconv.Atoi(m[2]); hours > 0 {
+			return math.Max(1, math.Ceil(24/float64(hours)))
+		}
+	}
+	return 1
+}
+
+// dailyMg is the strength in milligrams times dosesPerDay; ok is false for non-mass units.
+func (s MedicationSig) dailyMg() (float64, bool) {
+	mg, ok := s.doseMg()
+	return mg * s.dosesPerDay(), ok
+}
+
+func formatMg(mg float64) string {
+	return strconv.FormatFloat(mg, 'f', -1, 64)
+}
+
+// wordIndex returns the byte offset of phrase in text when it appears on word boundaries, or -1.
+func wordIndex(text, phrase string) int {
+	from := 0
+	for {
+		idx := strings.Index(text[from:], phrase)
+		if idx < 0 {
+			return -1
+		}
+		idx += from
+		end := idx + len(phrase)
+		if (idx == 0 || !isWordByte(text[idx-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return idx
+		}
+		from = idx + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMedicationSig(t *testing.T) {
+	cases := []struct {
+		in   string
+		want MedicationSig
+	}{
+		{"tadalafil 5mg PO daily", MedicationSig{Name: "tadalafil", Generic: "tadalafil", Dose: 5, Unit: "mg", Route: "oral", Frequency: "daily"}},
+		{"Nitroglycerin 0.4 mg SL PRN chest pain", MedicationSig{Name: "nitroglycerin", Generic: "nitroglycerin", Dose: 0.4, Unit: "mg", Route: "sublingual", PRN: true}},
+		{"Viagra 50mg as needed", MedicationSig{Name: "viagra", Generic: "sildenafil", Dose: 50, Unit: "mg", PRN: true}},
+		{"isosorbide mononitrate ER 30mg qam", MedicationSig{Name: "isosorbide mononitrate er", Generic: "isosorbide mononitrate", Dose: 30, Unit: "mg", Frequency: "every morning"}},
+		{"Lisinopril | 10mg | BID", MedicationSig{Name: "lisinopril", Dose: 10, Unit: "mg", Frequency: "twice daily"}},
+		{"levothyroxine 75 mcg q24h", MedicationSig{Name: "levothyroxine", Dose: 75, Unit: "mcg", Frequency: "every 24 hours"}},
+		{"Tadalafil 5mg twice daily", MedicationSig{Name: "tadalafil", Generic: "tadalafil", Dose: 5, Unit: "mg", Frequency: "twice daily"}},
+		{"metoprolol 25mg twice a day", MedicationSig{Name: "metoprolol", Dose: 25, Unit: "mg", Frequency: "twice daily"}},
+		{"Metformin 500mg three times daily", MedicationSig{Name: "metformin", Dose: 500, Unit: "mg", Frequency: "three times daily"}},
+		{"amoxicillin 500 mg tid", MedicationSig{Name: "amoxicillin", Dose: 500, Unit: "mg", Frequency: "three times daily"}},
+		{"furosemide 40mg bid", MedicationSig{Name: "furosemide", Dose: 40, Unit: "mg", Frequency: "twice daily"}},
+		{"alendronate 70mg once weekly", MedicationSig{Name: "alendronate", Dose: 70, Unit: "mg", Frequency: "weekly"}},
+		{"Tamsulosin | Unknown dose | Unknown freq", MedicationSig{Name: "tamsulosin", Generic: "tamsulosin"}},
+	}
+	for _, tc := range cases {
+		got, ok := parseMedicationSig(tc.in)
+		if !ok {
+			t.Fatalf("%q: expected a parsed sig", tc.in)
+		}
+		if got.Name != tc.want.Name || got.Generic != tc.want.Generic || got.Dose != tc.want.Dose || got.Unit != tc.want.Unit ||
+			got.Route != tc.want.Route || got.Frequency != tc.want.Frequency || got.PRN != tc.want.PRN {
+			t.Errorf("%q: got %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParsePatientMedicationsPrefersDosedEntry(t *testing.T) {
+	meds := parsePatientMedications("Cialis, metformin", "tadalafil | 10mg | daily")
+	if len(meds) != 2 {
+		t.Fatalf("expected 2 medications, got %+v", meds)
+	}
+	if meds[0].Generic != "tadalafil" || meds[0].Dose != 10 {
+		t.Fatalf("expected dosed tadalafil entry to win, got %+v", meds[0])
+	}
+	if mg, ok := meds[0].doseMg(); !ok || mg != 10 {
+		t.Fatalf("expected 10mg, got %v %v", mg, ok)
+	}
+}
+
+func TestMedicationsParseEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/medications/parse", strings.NewReader(`{"medications":"sildenafil 25mg prn; aspirin 81 mg daily"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Medications []MedicationSig `json:"medications"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Medications) != 2 || resp.Medications[0].Dose != 25 || !resp.Medications[0].PRN || resp.Medications[1].Dose != 81 {
+		t.Fatalf("unexpected parse result: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// modelSchemaError is returned when a model response cannot be repaired into a DiagnosticResult.
+type modelSchemaError struct {
+	Violations []validationError
+}
+
+func (e *modelSchemaError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return "model response failed schema validation: " + strings.Join(parts, "; ")
+}
+
+var severityAliases = map[string]string{
+	"HIGH": "HIGH", "SEVERE": "HIGH", "CRITICAL": "HIGH", "MAJOR": "HIGH", "CONTRAINDICATED": "HIGH",
+	"MEDIUM": "MEDIUM", "MODERATE": "MEDIUM", "MED": "MEDIUM", "INTERMEDIATE": "MEDIUM",
+	"LOW": "LOW", "MINOR": "LOW", "MILD": "LOW", "MINIMAL": "LOW", "NONE": "LOW",
+}
+
+// normalizeModelResult decodes a model's JSON object into a DiagnosticResult, coercing enums,
+// numeric strings and ranges where the intent is unambiguous. Anything that cannot be repaired is
+// reported as a violation.
+func normalizeModelResult(raw map[string]any) (DiagnosticResult, error) {
+	var errs []validationError
+	add := func(field, msg string) {
+		errs = append(errs, validationError{Field: field, Message: msg})
+	}
+
+	out := DiagnosticResult{Source: "model"}
+
+	score, hasScore := coerceNumber(raw["riskScore"])
+	if raw["riskScore"] != nil && !hasScore {
+		add("riskScore", fmt.Sprintf("expected a number, got %v", raw["riskScore"]))
+	}
+	level, hasLevel := coerceSeverity(raw["riskLevel"])
+	if raw["riskLevel"] != nil && !hasLevel {
+		add("riskLevel", fmt.Sprintf("expected HIGH, MEDIUM or LOW, got %v", raw["riskLevel"]))
+	}
+	switch {
+	case hasScore && (score < 0 || score > 100):
+		add("riskScore", fmt.Sprintf("must be between 0 and 100, got %v", score))
+	case raw["riskScore"] == nil && raw["riskLevel"] == nil:
+		add("riskLevel", "riskLevel or riskScore is required")
+	}
+	out.RiskScore = int(math.Round(score))
+	out.RiskLevel = level
+	if !hasLevel && hasScore {
+		out.RiskLevel = riskLevelForScore(out.RiskScore)
+	}
+
+	out.Interactions = []Interaction{}
+	for i, item := range coerceObjects(raw, "interactions", add) {
+		field := fmt.Sprintf("interactions[%d]", i)
+		sev, ok := coerceSeverity(item["severity"])
+		if !ok {
+			add(field+".severity", fmt.Sprintf("expected HIGH, MEDIUM or LOW, got %v", item["severity"]))
+		}
+		pair := coerceString(item["pair"])
+		if pair == "" {
+			add(field+".pair", "is required")
+		}
+		out.Interactions = append(out.Interactions, Interaction{Pair: pair, Severity: sev, Note: coerceString(item["note"])})
+	}
+
+	out.Contraindications = []Contraindication{}
+	for i, item := range coerceObjects(raw, "contraindications", add) {
+		field := fmt.Sprintf("contraindications[%d]", i)
+		sev, ok := coerceSeverity(item["severity"])
+		if !ok {
+			add(field+".severity", fmt.Sprintf("expected HIGH, MEDIUM or LOW, got %v", item["severity"]))
+		}
+		label := coerceString(item["conditionOrAllergy"])
+		if label == "" {
+			add(field+".conditionOrAllergy", "is required")
+		}
+		out.Contraindications = append(out.Contraindications, Contraindication{ConditionOrAllergy: label, Severity: sev, Note: coerceString(item["note"])})
+	}
+
+	out.DosingConcerns = []DosingConcern{}
+	for i, item := range coerceObjects(raw, "dosingConcerns", add) {
+		field := fmt.Sprintf("dosingConcerns[%d]", i)
+		sev, ok := coerceSeverity(item["severity"])
+		if !ok {
+			add(field+".severity", fmt.Sprintf("expected HIGH, MEDIUM or LOW, got %v", item["severity"]))
+		}
+		factor := coerceString(item["factor"])
+		if factor == "" {
+			add(field+".factor", "is required")
+		}
+		out.DosingConcerns = append(out.DosingConcerns, DosingConcern{Factor: factor, Severity: sev, Recommendation: coerceString(item["recommendation"])})
+	}
+
+	switch plan := raw["plan"].(type) {
+	case map[string]any:
+		out.Plan = Plan{
+			Medication: coerceString(plan["medication"]),
+			Dosage:     coerceString(plan["dosage"]),
+			Duration:   coerceString(plan["duration"]),
+			Rationale:  coerceString(plan["rationale"]),
+		}
+	case string:
+		out.Plan = Plan{Medication: plan}
+	case nil:
+	default:
+		add("plan", "expected an object")
+	}
+	if strings.TrimSpace(out.Plan.Medication) == "" {
+		add("plan.medication", "is required")
+	}
+
+	out.Alternatives = []Alternative{}
+	if alts, ok := raw["alternatives"].([]any); ok {
+		for i, alt := range alts {
+			field := fmt.Sprintf("alternatives[%d]", i)
+			switch v := alt.(type) {
+			case string:
+				out.Alternatives = append(out.Alternatives, Alternative{Option: v})
+			case map[string]any:
+				option := coerceString(v["option"])
+				if option == "" {
+					option = coerceString(v["name"])
+				}
+				if option == "" {
+					add(field+".option", "is required")
+				}
+				conf, ok := coerceFraction(v["confidence"])
+				if v["confidence"] != nil && !ok {
+					add(field+".confidence", fmt.Sprintf("must be between 0 and 1, got %v", v["confidence"]))
+				}
+				out.Alternatives = append(out.Alternatives, Alternative{Option: option, Confidence: conf})
+			default:
+				add(field, "expected a string or object")
+			}
+		}
+	} else if raw["alternatives"] != nil {
+		add("alternatives", "expected an array")
+	}
+
+	conf, ok := coerceFraction(raw["confidenceScore"])
+	if raw["confidenceScore"] != nil && !ok {
+		add("confidenceScore", fmt.Sprintf("must be between 0 and 1, got %v", raw["confidenceScore"]))
+	}
+	out.ConfidenceScore = conf
+	out.RecommendationConfidence.Plan = conf
+	if rc, isMap := raw["recommendationConfidence"].(map[string]any); isMap && rc["plan"] != nil {
+		planConf, ok := coerceFraction(rc["plan"])
+		if !ok {
+			add("recommendationConfidence.plan", fmt.Sprintf("must be between 0 and 1, got %v", rc["plan"]))
+		}
+		out.RecommendationConfidence.Plan = planConf
+	}
+
+	out.Issues = []string{}
+	if issues, ok := raw["issues"].([]any); ok {
+		for _, issue := range issues {
+			if s := coerceString(issue); s != "" {
+				out.Issues = append(out.Issues, s)
+			}
+		}
+	}
+	if len(out.Issues) == 0 {
+		out.Issues = buildIssues(out.Interactions, out.Contraindications, out.DosingConcerns)
+	}
+
+	if len(errs) > 0 {
+		return DiagnosticResult{}, &modelSchemaError{Violations: errs}
+	}
+	return out, nil
+}
+
+// coerceObjects returns raw[key] as a list of objects, reporting entries of any other shape.
+func coerceObjects(raw map[string]any, key string, add func(field, msg string)) []map[string]any {
+	value, present := raw[key]
+	if !present || value == nil {
+		return nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		add(key, "expected an array")
+		return nil
+	}
+	out := make([]map[string]any, 0, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			add(fmt.Sprintf("%s[%d]", key, i), "expected an object")
+			continue
+		}
+		out = append(out, obj)
+	}
+	return out
+}
+
+func coerceSeverity(v any) (string, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return "", false
+	}
+	sev, ok := severityAliases[strings.ToUpper(strings.TrimSpace(s))]
+	return sev, ok
+}
+
+// coerceNumber accepts JSON numbers and numeric strings such as "72" or "72%".
+func coerceNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(n), "%"), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// coerceFraction accepts a 0-1 value, or a 0-100 percentage which it scales down.
+func coerceFraction(v any) (float64, bool) {
+	f, ok := coerceNumber(v)
+	if !ok {
+		return 0, false
+	}
+	if s, isString := v.(string); (isString && strings.HasSuffix(strings.TrimSpace(s), "%")) || (f > 1 && f <= 100) {
+		f /= 100
+	}
+	if f < 0 || f > 1 {
+		return 0, false
+	}
+	return f, true
+}
+
+func coerceString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return strings.TrimSpace(s)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func riskLevelForScore(score int) string {
+	switch {
+	case score >= 60:
+		return "HIGH"
+	case score >= 30:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func decodeRaw(t *testing.T, body string) map[string]any {
+	t.Helper()
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(body), &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestNormalizeModelResultRepairs(t *testing.T) {
+	result, err := normalizeModelResult(decodeRaw(t, `{
+		"riskScore": "72",
+		"riskLevel": "moderate",
+		"interactions": [{"pair": "Tamsulosin + Tadalafil", "severity": "Moderate", "note": "hypotension"}],
+		"dosingConcerns": [{"factor": "age", "severity": "minor", "recommendation": "start low"}],
+		"plan": {"medication": "Tadalafil", "dosage": "2.5mg Daily"},
+		"alternatives": ["Vacuum device", {"option": "Referral", "confidence": 65}],
+		"confidenceScore": "80%"
+	}`))
+	if err != nil {
+		t.Fatalf("expected repairable output, got %v", err)
+	}
+	if result.RiskScore != 72 || result.RiskLevel != "MEDIUM" {
+		t.Fatalf("expected coerced score/level, got %d %s", result.RiskScore, result.RiskLevel)
+	}
+	if result.Interactions[0].Severity != "MEDIUM" || result.DosingConcerns[0].Severity != "LOW" {
+		t.Fatalf("expected severity aliases to normalize, got %+v %+v", result.Interactions, result.DosingConcerns)
+	}
+	if len(result.Alternatives) != 2 || result.Alternatives[0].Option != "Vacuum device" || result.Alternatives[1].Confidence != 0.65 {
+		t.Fatalf("unexpected alternatives: %+v", result.Alternatives)
+	}
+	if result.ConfidenceScore != 0.8 || result.Source != "model" {
+		t.Fatalf("unexpected confidence/source: %v %s", result.ConfidenceScore, result.Source)
+	}
+	if len(result.Issues) != 2 {
+		t.Fatalf("expected issues derived from findings, got %v", result.Issues)
+	}
+}
+
+func TestNormalizeModelResultDerivesLevelFromScore(t *testing.T) {
+	result, err := normalizeModelResult(decodeRaw(t, `{"riskScore": 65.4, "plan": {"medication": "None"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RiskScore != 65 || result.RiskLevel != "HIGH" {
+		t.Fatalf("expected level derived from score, got %d %s", result.RiskScore, result.RiskLevel)
+	}
+}
+
+func TestNormalizeModelResultViolations(t *testing.T) {
+	_, err := normalizeModelResult(decodeRaw(t, `{
+		"riskScore": 140,
+		"riskLevel": "purple",
+		"interactions": ["nitrates + sildenafil"],
+		"contraindications": [{"conditionOrAllergy": "Pregnancy", "severity": "???"}],
+		"confidenceScore": 250
+	}`))
+	var schemaErr *modelSchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected schema error, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, v := range schemaErr.Violations {
+		fields[v.Field] = true
+	}
+	for _, want := range []string{"riskScore", "riskLevel", "interactions[0]", "contraindications[0].severity", "plan.medication", "confidenceScore"} {
+		if !fields[want] {
+			t.Errorf("expected violation for %s, got %+v", want, schemaErr.Violations)
+		}
+	}
+}
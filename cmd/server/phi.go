@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	redactionOff          = "off"
+	redactionStrip        = "strip"
+	redactionPseudonymize = "pseudonymize"
+
+	// safeHarborMaxAge is the oldest age HIPAA Safe Harbor allows to be disclosed as-is; older
+	// patients are reported as this age.
+	safeHarborMaxAge = 90
+)
+
+// RedactedField records how many identifiers of one kind were removed from one field. The original
+// values are never recorded.
+type RedactedField struct {
+	Field string `json:"field"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+// RedactionReport is attached to results that involved an external model and lists what was
+// de-identified before the patient data left the server.
+type RedactionReport struct {
+	Mode   string          `json:"mode"`
+	Fields []RedactedField `json:"fields"`
+}
+
+// identifierPatterns are applied to free text in order; earlier patterns win overlapping matches.
+var identifierPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"email", regexp.MustCompile(`(?i)\b[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}\b`)},
+	{"mrn", regexp.MustCompile(`(?i)\b(?:mrn|medical record(?: number| no\.?)?|patient id)\s*[:#]?\s*[a-z0-9\-]*\d[a-z0-9\-]*`)},
+	{"date", regexp.MustCompile(`(?i)\b(?:\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[/.\-]\d{1,2}[/.\-]\d{2,4}|(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}|\d{1,2}\s+(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{4})\b`)},
+	{"phone", regexp.MustCompile(`(?:\+?\d{1,2}[\s.\-]?)?(?:\(\d{3}\)|\b\d{3})[\s.\-]?\d{3}[\s.\-]?\d{4}\b`)},
+}
+
+// redactor de-identifies patient data before it is sent to an external model. In strip mode the
+// name is dropped; in pseudonymize mode it is replaced by a keyed hash so repeat visits by the same
+// patient map to the same reference without revealing who it is.
+type redactor struct {
+	mode string
+	key  []byte
+}
+
+// newRedactor builds a redactor for mode ("" means pseudonymize). Without a key, a random one is
+// generated and pseudonyms are stable only for the life of the process.
+func newRedactor(mode, key string) *redactor {
+	if mode == "" {
+		mode = redactionPseudonymize
+	}
+	r := &redactor{mode: mode, key: []byte(key)}
+	if mode == redactionPseudonymize && key == "" {
+		r.key = make([]byte, 32)
+		_, _ = rand.Read(r.key)
+	}
+	return r
+}
+
+func validRedactionMode(mode string) bool {
+	switch mode {
+	case redactionOff, redactionStrip, redactionPseudonymize:
+		return true
+	}
+	return false
+}
+
+// pseudonym returns the stable reference for a patient name.
+func (r *redactor) pseudonym(name string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(strings.ToLower(strings.Join(strings.Fields(name), " "))))
+	return "patient-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// deidentify returns the copy of data to send to an external model and the record of what was
+// removed. With redaction off, data is returned unchanged and the report is nil.
+func (r *redactor) deidentify(data PatientData) (PatientData, *RedactionReport) {
+	if r == nil || r.mode == redactionOff {
+		return data, nil
+	}
+	report := &RedactionReport{Mode: r.mode, Fields: []RedactedField{}}
+	out := data
+	out.Conditions = append([]string(nil), data.Conditions...)
+
+	nameMarker := "[NAME]"
+	if name := strings.TrimSpace(data.Name); name != "" {
+		out.Name = ""
+		if r.mode == redactionPseudonymize {
+			out.Name = r.pseudonym(name)
+			nameMarker = out.Name
+		}
+		report.add("name", "name", 1)
+	}
+	if data.Age > safeHarborMaxAge {
+		out.Age = safeHarborMaxAge
+		report.add("age", "age", 1)
+	}
+
+	nameRe := nameTokenPattern(data.Name)
+	scrub := func(field string, text *string) {
+		// Structured identifiers first, so a name inside an email address goes with the address.
+		for _, p := range identifierPatterns {
+			marker := "[" + strings.ToUpper(p.kind) + "]"
+			*text = replaceCounting(p.re, *text, marker, func(n int) { report.add(field, p.kind, n) })
+		}
+		if nameRe != nil {
+			*text = replaceCounting(nameRe, *text, nameMarker, func(n int) { report.add(field, "name", n) })
+		}
+	}
+	scrub("medications", &out.Medications)
+	scrub("medicationDetails", &out.MedicationDetails)
+	scrub("allergies", &out.Allergies)
+	scrub("complaint", &out.Complaint)
+	for i := range out.Conditions {
+		scrub(fmt.Sprintf("conditions[%d]", i), &out.Conditions[i])
+	}
+	return out, report
+}
+
+func (r *RedactionReport) add(field, kind string, n int) {
+	if n > 0 {
+		r.Fields = append(r.Fields, RedactedField{Field: field, Kind: kind, Count: n})
+	}
+}
+
+// nameTokenPattern matches the parts of the patient's name (three letters or longer) as whole words.
+func nameTokenPattern(name string) *regexp.Regexp {
+	var parts []string
+	for _, token := range strings.Fields(name) {
+		if len([]rune(token)) >= 3 {
+			parts = append(parts, regexp.QuoteMeta(token))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(parts, "|") + `)\b`)
+}
+
+func replaceCounting(re *regexp.Regexp, text, marker string, count func(int)) string {
+	n := 0
+	out := re.ReplaceAllStringFunc(text, func(string) string {
+		n++
+		return marker
+	})
+	count(n)
+	return out
+}
+
+// modelInput is the patient payload sent to external models: the clinically relevant fields, plus
+// the patient reference only when one survived de-identification.
+func modelInput(data PatientData) map[string]any {
+	out := map[string]any{
+		"age":               data.Age,
+		"weight":            data.Weight,
+		"height":            data.Height,
+		"bmi":               data.BMI,
+		"bpSystolic":        data.BPSystolic,
+		"bpDiastolic":       data.BPDiastolic,
+		"smoking":           data.Smoking,
+		"alcohol":           data.Alcohol,
+		"exercise":          data.Exercise,
+		"conditions":        data.Conditions,
+		"medications":       data.Medications,
+		"medicationDetails": data.MedicationDetails,
+		"allergies":         data.Allergies,
+		"complaint":         data.Complaint,
+	}
+	if data.Name != "" {
+		out["name"] = data.Name
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeidentifyFreeText(t *testing.T) {
+	data := PatientData{
+		Name:        "Alex Rivera",
+		Age:         93,
+		Complaint:   "Alex reports ED since 03/14/2024; call 555-123-4567 or alex.r@example.com. MRN: 00482913",
+		Allergies:   "penicillin (noted Jan 5, 2023)",
+		Conditions:  []string{"Hypertension", "seen by Dr. Rivera on 2024-02-01"},
+		Medications: "tadalafil 5mg daily",
+	}
+	out, report := newRedactor(redactionStrip, "").deidentify(data)
+
+	if out.Name != "" || out.Age != safeHarborMaxAge {
+		t.Fatalf("expected name stripped and age capped, got %q %d", out.Name, out.Age)
+	}
+	want := "[NAME] reports ED since [DATE]; call [PHONE] or [EMAIL]. [MRN]"
+	if out.Complaint != want {
+		t.Fatalf("complaint not scrubbed:\n got %q\nwant %q", out.Complaint, want)
+	}
+	if out.Allergies != "penicillin (noted [DATE])" || out.Conditions[1] != "seen by Dr. [NAME] on [DATE]" {
+		t.Fatalf("unexpected scrubbed fields: %q %q", out.Allergies, out.Conditions[1])
+	}
+	if out.Medications != data.Medications || data.Conditions[1] == out.Conditions[1] {
+		t.Fatal("medications must pass through and the input must not be modified")
+	}
+
+	counts := map[string]int{}
+	for _, f := range report.Fields {
+		counts[f.Field+"/"+f.Kind] += f.Count
+	}
+	for key, n := range map[string]int{"name/name": 1, "age/age": 1, "complaint/name": 1, "complaint/date": 1, "complaint/phone": 1, "complaint/email": 1, "complaint/mrn": 1, "conditions[1]/name": 1} {
+		if counts[key] != n {
+			t.Errorf("expected %s=%d in report, got %v", key, n, report.Fields)
+		}
+	}
+	if strings.Contains(toJSON(report), "Alex") || strings.Contains(toJSON(report), "555") {
+		t.Fatalf("report must not carry the redacted values: %s", toJSON(report))
+	}
+}
+
+func TestPseudonymsAreStableAndKeyed(t *testing.T) {
+	a := newRedactor(redactionPseudonymize, "k1")
+	first, _ := a.deidentify(PatientData{Name: "Alex  Rivera", Complaint: "alex has ED"})
+	second, _ := a.deidentify(PatientData{Name: "alex rivera"})
+	other, _ := newRedactor(redactionPseudonymize, "k2").deidentify(PatientData{Name: "Alex Rivera"})
+
+	if !strings.HasPrefix(first.Name, "patient-") || first.Name != second.Name || first.Name == other.Name {
+		t.Fatalf("unexpected pseudonyms %q %q %q", first.Name, second.Name, other.Name)
+	}
+	if first.Complaint != first.Name+" has ED" {
+		t.Fatalf("expected name in free text replaced by pseudonym, got %q", first.Complaint)
+	}
+	if out, report := newRedactor(redactionOff, "").deidentify(PatientData{Name: "Alex"}); out.Name != "Alex" || report != nil {
+		t.Fatalf("expected redaction off to pass data through, got %q %v", out.Name, report)
+	}
+}
+
+func TestModelRequestsAreDeidentified(t *testing.T) {
+	var sent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = body.Messages[len(body.Messages)-1].Content
+		content, _ := json.Marshal(map[string]any{"riskLevel": "LOW", "plan": map[string]any{"medication": "Tadalafil"}})
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": string(content)}}},
+		})
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{OpenAIBaseURL: upstream.URL, PHIRedaction: redactionStrip})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/hybrid?model=openai", strings.NewReader(`{"name":"Alex Rivera","medications":"tadalafil","complaint":"email alex@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	var input map[string]any
+	if err := json.Unmarshal([]byte(sent), &input); err != nil {
+		t.Fatalf("upstream payload is not JSON: %q", sent)
+	}
+	if _, ok := input["name"]; ok || input["complaint"] != "email [EMAIL]" || input["medications"] != "tadalafil" {
+		t.Fatalf("unexpected upstream payload %v", input)
+	}
+	var result DiagnosticResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Redaction == nil || result.Redaction.Mode != redactionStrip {
+		t.Fatalf("expected redaction report on result, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex Rivera","medications":"tadalafil"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), `"redaction"`) {
+		t.Fatalf("rules-only results never leave the server and carry no redaction report: %s", w.Body.String())
+	}
+}
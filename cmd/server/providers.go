@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	mockProviderName     = "mock"
+	defaultGeminiModel   = "gemini-2.5-flash-preview-09-2025"
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	defaultOpenAIModel   = "gpt-4o"
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+)
+
+// Provider is a diagnostic engine reachable at POST /api/diagnostics/:provider.
+type Provider interface {
+	Name() string
+	Available() bool
+	Analyze(ctx context.Context, data PatientData) (DiagnosticResult, error)
+}
+
+// FallbackAttempt records a provider that was skipped or failed before another one answered.
+type FallbackAttempt struct {
+	Provider string `json:"provider"`
+	Reason   string `json:"reason"`
+	Breaker  string `json:"breaker"`
+}
+
+// FallbackReport is attached to a result that was served by a provider other than the one requested.
+type FallbackReport struct {
+	Requested string            `json:"requested"`
+	Attempts  []FallbackAttempt `json:"attempts"`
+}
+
+// upstreamStatusError is returned when a vendor answers with a non-2xx status.
+type upstreamStatusError struct {
+	Provider   string
+	StatusCode int
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("%s status %d", e.Provider, e.StatusCode)
+}
+
+// circuitOpenError is returned when every candidate provider was skipped by an open breaker.
+type circuitOpenError struct {
+	Provider string
+}
+
+func (e *circuitOpenError) Error() string {
+	return e.Provider + " circuit breaker is open"
+}
+
+// providerFactory builds an LLM provider from configuration. A new provider only needs an entry in
+// providerFactories to become selectable through PROVIDERS and PROVIDER_FALLBACK.
+type providerFactory struct {
+	name  string
+	build func(cfg *Config) Provider
+}
+
+// providerFactories lists the LLM providers in default preference order.
+var providerFactories = []providerFactory{
+	{name: "openai", build: func(cfg *Config) Provider {
+		return &openAIProvider{
+			apiKey:  cfg.OpenAIAPIKey,
+			baseURL: getOr(cfg.OpenAIBaseURL, defaultOpenAIBaseURL),
+			model:   getOr(cfg.OpenAIModel, defaultOpenAIModel),
+			headers: cfg.OpenAIExtraHeaders,
+		}
+	}},
+	{name: "gemini", build: func(cfg *Config) Provider {
+		return &geminiProvider{
+			apiKey:  cfg.GeminiAPIKey,
+			baseURL: defaultGeminiBaseURL,
+			model:   getOr(cfg.GeminiModel, defaultGeminiModel),
+		}
+	}},
+}
+
+func findProviderFactory(name string) (providerFactory, bool) {
+	for _, f := range providerFactories {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return providerFactory{}, false
+}
+
+// parseProviderList parses PROVIDERS: the LLM providers to enable, in preference order. Empty
+// enables every known provider.
+func parseProviderList(raw string) ([]string, error) {
+	var out []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || containsString(out, name) {
+			continue
+		}
+		if _, ok := findProviderFactory(name); !ok {
+			return nil, fmt.Errorf("unknown provider %q", name)
+		}
+		out = append(out, name)
+	}
+	if out == nil {
+		for _, f := range providerFactories {
+			out = append(out, f.name)
+		}
+	}
+	return out, nil
+}
+
+// providerRegistry keeps providers in preference order; the first available non-mock provider is
+// the default model. Every LLM provider sits behind its own circuit breaker, and failures walk the
+// configured fallback chain.
+type providerRegistry struct {
+	order    []string
+	byName   map[string]Provider
+	breakers map[string]*circuitBreaker
+	fallback []string
+	redactor *redactor
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+func newProviderRegistry(cfg *Config) *providerRegistry {
+	reg := &providerRegistry{
+		byName:           map[string]Provider{},
+		breakers:         map[string]*circuitBreaker{},
+		fallback:         cfg.ProviderFallback,
+		redactor:         newRedactor(cfg.PHIRedaction, cfg.PHIPseudonymKey),
+		breakerThreshold: cfg.BreakerThreshold,
+		breakerCooldown:  cfg.BreakerCooldown,
+	}
+	reg.register(mockProvider{})
+	names := cfg.Providers
+	if names == nil {
+		names, _ = parseProviderList("")
+	}
+	for _, name := range names {
+		if f, ok := findProviderFactory(name); ok {
+			reg.register(f.build(cfg))
+		}
+	}
+	return reg
+}
+
+func (r *providerRegistry) register(p Provider) {
+	if _, exists := r.byName[p.Name()]; !exists {
+		r.order = append(r.order, p.Name())
+	}
+	r.byName[p.Name()] = p
+	if p.Name() != mockProviderName {
+		r.breakers[p.Name()] = newCircuitBreaker(r.breakerThreshold, r.breakerCooldown)
+	}
+}
+
+func (r *providerRegistry) get(name string) (Provider, bool) {
+	p, ok := r.byName[name]
+	return p, ok
+}
+
+func (r *providerRegistry) availability() map[string]bool {
+	out := make(map[string]bool, len(r.byName))
+	for name, p := range r.byName {
+		out[name] = p.Available()
+	}
+	return out
+}
+
+// firstAvailableModel returns the first available LLM provider, or "" when only mock is usable.
+func (r *providerRegistry) firstAvailableModel() string {
+	for _, name := range r.order {
+		if name != mockProviderName && r.byName[name].Available() {
+			return name
+		}
+	}
+	return ""
+}
+
+// breakerStatus reports the circuit breaker state of every LLM provider.
+func (r *providerRegistry) breakerStatus() map[string]BreakerStatus {
+	out := make(map[string]BreakerStatus, len(r.breakers))
+	for name, b := range r.breakers {
+		out[name] = b.status()
+	}
+	return out
+}
+
+// chainFor returns the providers to try for a request to name: name itself, then the entries that
+// follow it in the fallback chain (or the whole chain when name is not part of it).
+func (r *providerRegistry) chainFor(name string) []string {
+	chain := []string{name}
+	if name == mockProviderName {
+		return chain
+	}
+	rest := r.fallback
+	for i, candidate := range r.fallback {
+		if candidate == name {
+			rest = r.fallback[i+1:]
+			break
+		}
+	}
+	for _, candidate := range rest {
+		if candidate != name && !containsString(chain, candidate) {
+			chain = append(chain, candidate)
+		}
+	}
+	return chain
+}
+
+// analyze runs the named provider, falling back along the configured chain when it fails or its
+// breaker is open. The returned name is the provider that produced the result; results served by a
+// fallback carry a FallbackReport. LLM providers only ever see the de-identified copy of data; once
+// one has been called the result carries the RedactionReport. When every candidate fails the last
+// error is returned alongside an otherwise empty result whose FallbackReport lists the attempts.
+func (r *providerRegistry) analyze(ctx context.Context, name string, data PatientData) (DiagnosticResult, string, error) {
+	var attempts []FallbackAttempt
+	var lastErr error
+	outbound, redaction := r.redactor.deidentify(data)
+	sent := false
+	for _, candidate := range r.chainFor(name) {
+		provider, ok := r.byName[candidate]
+		if !ok || !provider.Available() {
+			continue
+		}
+		breaker := r.breakers[candidate]
+		if !breaker.allow() {
+			attempts = append(attempts, FallbackAttempt{Provider: candidate, Reason: "circuit_open", Breaker: breakerOpen})
+			if lastErr == nil {
+				lastErr = &circuitOpenError{Provider: candidate}
+			}
+			continue
+		}
+
+		input := data
+		if candidate != mockProviderName {
+			input, sent = outbound, true
+		}
+		result, err := provider.Analyze(ctx, input)
+		recordUsage(ctx, candidate, result.Usage)
+		if err == nil {
+			breaker.success()
+			if len(attempts) > 0 {
+				result.Fallback = &FallbackReport{Requested: name, Attempts: attempts}
+			}
+			if sent {
+				result.Redaction = redaction
+			}
+			return result, candidate, nil
+		}
+		if ctx.Err() != nil {
+			// The caller went away; that says nothing about the vendor.
+			breaker.release()
+			return DiagnosticResult{}, candidate, err
+		}
+		breaker.failure()
+		log.Printf("%s provider error: %v", candidate, err)
+		attempts = append(attempts, FallbackAttempt{Provider: candidate, Reason: failureReason(err), Breaker: breaker.status().State})
+		lastErr = err
+	}
+	return DiagnosticResult{Fallback: &FallbackReport{Requested: name, Attempts: attempts}}, "", lastErr
+}
+
+// failureReason classifies a provider error without echoing upstream URLs, which may carry keys.
+func failureReason(err error) string {
+	var schemaErr *modelSchemaError
+	var statusErr *upstreamStatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &schemaErr):
+		return "schema_invalid"
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("status_%d", statusErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "upstream_error"
+	}
+}
+
+func getOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// mockProvider runs the deterministic safety engine.
+type mockProvider struct{}
+
+func (mockProvider) Name() string    { return mockProviderName }
+func (mockProvider) Available() bool { return true }
+
+func (mockProvider) Analyze(ctx context.Context, data PatientData) (DiagnosticResult, error) {
+	return evaluateRulePack(rulePackFrom(ctx), data), nil
+}
+
+// openAIProvider talks to the OpenAI chat completions API or any OpenAI-compatible server
+// (vLLM, llama.cpp, Ollama) when baseURL points elsewhere.
+type openAIProvider struct {
+	apiKey  string
+	baseURL string
+	model   string
+	headers map[string]string
+}
+
+func (p *openAIProvider) Name() string { return "openai" }
+
+// Available reports whether the provider is usable: api.openai.com needs a key, while a custom
+// OpenAI-compatible endpoint may run without one.
+func (p *openAIProvider) Available() bool {
+	return p.apiKey != "" || strings.TrimRight(p.baseURL, "/") != defaultOpenAIBaseURL
+}
+
+func (p *openAIProvider) Analyze(ctx context.Context, data PatientData) (DiagnosticResult, error) {
+	bodyBytes, err := json.Marshal(map[string]any{
+		"model": p.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": systemPrompt},
+			{"role": "user", "content": toJSON(modelInput(data))},
+		},
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(p.baseURL, "/")+"/chat/completions", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("call openai: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return DiagnosticResult{}, &upstreamStatusError{Provider: "openai", StatusCode: resp.StatusCode}
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return DiagnosticResult{}, fmt.Errorf("decode openai response: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return DiagnosticResult{}, fmt.Errorf("openai response missing choices")
+	}
+	rawText := cleanupJSONText(parsed.Choices[0].Message.Content)
+	// The tokens are spent even when the answer is unusable, so usage travels with errors too.
+	var usage *TokenUsage
+	if parsed.Usage != nil {
+		usage = &TokenUsage{
+			PromptTokens:     parsed.Usage.PromptTokens,
+			CompletionTokens: parsed.Usage.CompletionTokens,
+			TotalTokens:      parsed.Usage.TotalTokens,
+		}
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(rawText), &out); err != nil {
+		return DiagnosticResult{Usage: usage}, fmt.Errorf("unmarshal openai payload: %w", err)
+	}
+	result, err := normalizeModelResult(out)
+	result.Usage = usage
+	return result, err
+}
+
+type geminiProvider struct {
+	apiKey  string
+	baseURL string
+	model   string
+}
+
+func (p *geminiProvider) Name() string    { return "gemini" }
+func (p *geminiProvider) Available() bool { return p.apiKey != "" }
+
+func (p *geminiProvider) Analyze(ctx context.Context, data PatientData) (DiagnosticResult, error) {
+	bodyBytes, err := json.Marshal(map[string]any{
+		"contents": []map[string]any{
+			{"parts": []map[string]string{{"text": fmt.Sprintf("Patient Data: %s", toJSON(modelInput(data)))}}},
+		},
+		"systemInstruction": map[string]any{
+			"parts": []map[string]string{{"text": systemPrompt}},
+		},
+	})
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent?key=%s", strings.TrimRight(p.baseURL, "/"), p.model, url.QueryEscape(p.apiKey))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return DiagnosticResult{}, fmt.Errorf("call gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return DiagnosticResult{}, &upstreamStatusError{Provider: "gemini", StatusCode: resp.StatusCode}
+	}
+
+	var parsed struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+		UsageMetadata *struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+			TotalTokenCount      int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return DiagnosticResult{}, fmt.Errorf("decode gemini response: %w", err)
+	}
+	if len(parsed.Candidates) == 0 || len(parsed.Candidates[0].Content.Parts) == 0 {
+		return DiagnosticResult{}, fmt.Errorf("gemini response missing content")
+	}
+	rawText := cleanupJSONText(parsed.Candidates[0].Content.Parts[0].Text)
+	var usage *TokenUsage
+	if parsed.UsageMetadata != nil {
+		usage = &TokenUsage{
+			PromptTokens:     parsed.UsageMetadata.PromptTokenCount,
+			CompletionTokens: parsed.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      parsed.UsageMetadata.TotalTokenCount,
+		}
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(rawText), &out); err != nil {
+		return DiagnosticResult{Usage: usage}, fmt.Errorf("unmarshal gemini payload: %w", err)
+	}
+	result, err := normalizeModelResult(out)
+	result.Usage = usage
+	return result, err
+}
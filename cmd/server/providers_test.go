@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubProvider struct {
+	name   string
+	result DiagnosticResult
+}
+
+func (s stubProvider) Name() string    { return s.name }
+func (s stubProvider) Available() bool { return true }
+func (s stubProvider) Analyze(context.Context, PatientData) (DiagnosticResult, error) {
+	return s.result, nil
+}
+
+func TestProviderRegistryAvailability(t *testing.T) {
+	reg := newProviderRegistry(&Config{GeminiAPIKey: "g"})
+	avail := reg.availability()
+	if !avail["mock"] || !avail["gemini"] || avail["openai"] {
+		t.Fatalf("unexpected availability: %v", avail)
+	}
+	if got := reg.firstAvailableModel(); got != "gemini" {
+		t.Fatalf("expected gemini as first available model, got %q", got)
+	}
+
+	reg.register(stubProvider{name: "local"})
+	if _, ok := reg.get("local"); !ok || !reg.availability()["local"] {
+		t.Fatal("expected registered provider to be reachable")
+	}
+	if got := newProviderRegistry(&Config{}).firstAvailableModel(); got != "" {
+		t.Fatalf("expected no model without keys, got %q", got)
+	}
+}
+
+func TestProviderRegistryFromConfig(t *testing.T) {
+	providers, err := parseProviderList("Gemini, openai")
+	if err != nil || strings.Join(providers, ",") != "gemini,openai" {
+		t.Fatalf("unexpected providers %v (%v)", providers, err)
+	}
+	if _, err := parseProviderList("anthropic"); err == nil {
+		t.Fatal("expected error for an unknown provider")
+	}
+
+	reg := newProviderRegistry(&Config{Providers: []string{"gemini"}, GeminiAPIKey: "g", GeminiModel: "gemini-2.5-pro", OpenAIAPIKey: "o"})
+	if _, ok := reg.get("openai"); ok {
+		t.Fatal("providers left out of PROVIDERS must not be registered")
+	}
+	p, ok := reg.get("gemini")
+	if !ok || p.(*geminiProvider).model != "gemini-2.5-pro" {
+		t.Fatalf("expected gemini with the configured model, got %+v", p)
+	}
+	if p, _ := newProviderRegistry(&Config{}).get("gemini"); p.(*geminiProvider).model != defaultGeminiModel {
+		t.Fatalf("expected default gemini model, got %+v", p)
+	}
+
+	t.Setenv("ENABLE_DB", "false")
+	t.Setenv("PROVIDERS", "openai")
+	t.Setenv("PROVIDER_FALLBACK", "gemini,rules")
+	if _, err := loadConfig(); err == nil {
+		t.Fatal("expected a fallback to a disabled provider to be rejected")
+	}
+}
+
+func TestDiagnosticsProviderRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{})
+
+	cases := map[string]int{
+		"/api/diagnostics/mock":      http.StatusOK,
+		"/api/diagnostics/gemini":    http.StatusServiceUnavailable,
+		"/api/diagnostics/anthropic": http.StatusNotFound,
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d (%s)", path, want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestOpenAIProviderCompatibleEndpoint(t *testing.T) {
+	var gotPath, gotModel, gotAuth, gotHeader string
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Tenant")
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotModel = body.Model
+		content, _ := json.Marshal(map[string]any{"riskLevel": "low", "plan": map[string]any{"medication": "Tadalafil"}})
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": string(content)}}},
+		})
+	}))
+	defer local.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		OpenAIBaseURL:      local.URL + "/v1",
+		OpenAIModel:        "llama-3.1-8b-instruct",
+		OpenAIExtraHeaders: map[string]string{"X-Tenant": "clinic-1"},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/diagnostics/openai", strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	if gotPath != "/v1/chat/completions" || gotModel != "llama-3.1-8b-instruct" {
+		t.Fatalf("unexpected upstream request: path=%q model=%q", gotPath, gotModel)
+	}
+	if gotAuth != "" || gotHeader != "clinic-1" {
+		t.Fatalf("unexpected upstream headers: auth=%q x-tenant=%q", gotAuth, gotHeader)
+	}
+	var result DiagnosticResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.RiskLevel != "LOW" {
+		t.Fatalf("unexpected result %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestParseHeaderList(t *testing.T) {
+	headers, err := parseHeaderList("x-api-version: 2; X-Tenant : clinic-1;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if headers["X-Api-Version"] != "2" || headers["X-Tenant"] != "clinic-1" {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+	if _, err := parseHeaderList("no-colon"); err == nil {
+		t.Fatal("expected error for entry without a colon")
+	}
+}
+
+func TestProviderFallbackAndBreaker(t *testing.T) {
+	calls := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		OpenAIBaseURL:    failing.URL,
+		ProviderFallback: []string{"openai", "gemini", "mock"},
+		BreakerThreshold: 1,
+	})
+	post := func(path string) DiagnosticResult {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d (%s)", path, w.Code, w.Body.String())
+		}
+		var result DiagnosticResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return result
+	}
+
+	first := post("/api/diagnostics/openai")
+	if first.Source != "rules" || first.Fallback == nil || first.Fallback.Attempts[0].Reason != "status_502" {
+		t.Fatalf("expected rules fallback after upstream 502, got %+v", first)
+	}
+	second := post("/api/diagnostics/hybrid?model=openai")
+	if calls != 1 {
+		t.Fatalf("expected open breaker to skip openai, got %d upstream calls", calls)
+	}
+	if second.Fallback == nil || second.Fallback.Attempts[0].Reason != "circuit_open" {
+		t.Fatalf("expected circuit_open attempt, got %+v", second.Fallback)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	var ready struct {
+		Providers map[string]BreakerStatus `json:"providers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ready); err != nil {
+		t.Fatalf("decode readyz: %v", err)
+	}
+	if ready.Providers["openai"].State != breakerOpen || ready.Providers["gemini"].State != breakerClosed {
+		t.Fatalf("unexpected breaker report: %+v", ready.Providers)
+	}
+}
+
+func TestProviderBreakerOpenWithoutFallback(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{OpenAIBaseURL: failing.URL, BreakerThreshold: 1})
+	for _, want := range []int{http.StatusBadGateway, http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/diagnostics/openai", strings.NewReader(`{"name":"Alex"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("expected %d, got %d (%s)", want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestModelErrorDoesNotLeakAPIKey(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	provider := &geminiProvider{apiKey: "secret-gemini-key", baseURL: closed.URL, model: defaultGeminiModel}
+	_, err := provider.Analyze(context.Background(), PatientData{Name: "Alex"})
+	if err == nil || !strings.Contains(err.Error(), "secret-gemini-key") {
+		t.Fatalf("expected a transport error carrying the request URL, got %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondModelError(c, "gemini", err)
+
+	if w.Code != http.StatusBadGateway || strings.Contains(w.Body.String(), "secret-gemini-key") {
+		t.Fatalf("expected a 502 without the API key, got %d %s", w.Code, w.Body.String())
+	}
+}
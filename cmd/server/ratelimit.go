@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// limiterSweepSize bounds how many idle buckets accumulate before they are pruned.
+	limiterSweepSize = 10000
+)
+
+// TokenUsage is the token accounting a provider reported for one call.
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// rateSpec is a request budget such as 30/m; the zero value disables limiting.
+type rateSpec struct {
+	Count int
+	Per   time.Duration
+}
+
+func (r rateSpec) String() string {
+	if r.Count == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Count, r.Per)
+}
+
+// parseRateSpec parses "N/s", "N/m" or "N/h"; "0" or "" disables the limit.
+func parseRateSpec(raw string) (rateSpec, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "0" {
+		return rateSpec{}, nil
+	}
+	count, unit, ok := strings.Cut(raw, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n < 0 {
+		return rateSpec{}, fmt.Errorf("expected N/s, N/m or N/h, got %q", raw)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[strings.TrimSpace(unit)]
+	if per == 0 {
+		return rateSpec{}, fmt.Errorf("expected N/s, N/m or N/h, got %q", raw)
+	}
+	return rateSpec{Count: n, Per: per}, nil
+}
+
+// rateLimiter is a per-client token bucket holding up to spec.Count requests, refilled evenly
+// over spec.Per.
+type rateLimiter struct {
+	spec rateSpec
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(spec rateSpec) *rateLimiter {
+	if spec.Count == 0 {
+		return nil
+	}
+	return &rateLimiter{spec: spec, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// allow takes one request from client's bucket, or reports how long until one is available.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(l.spec.Count) / l.spec.Per.Seconds()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= limiterSweepSize {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(l.spec.Count), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(l.spec.Count), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely; they are indistinguishable from new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= l.spec.Per {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// quotaTracker enforces daily (UTC) token and cost budgets per client. Usage is counted after the
+// provider answers, so a client may overshoot by one call before being cut off.
+type quotaTracker struct {
+	dailyTokens int
+	dailyCost   float64
+	prices      map[string]float64 // USD per 1K tokens, by provider
+	now         func() time.Time
+
+	mu    sync.Mutex
+	day   string
+	usage map[string]*clientUsage
+}
+
+type clientUsage struct {
+	tokens int
+	cost   float64
+}
+
+func newQuotaTracker(dailyTokens int, dailyCost float64, prices map[string]float64) *quotaTracker {
+	if dailyTokens <= 0 && dailyCost <= 0 {
+		return nil
+	}
+	return &quotaTracker{dailyTokens: dailyTokens, dailyCost: dailyCost, prices: prices, now: time.Now, usage: map[string]*clientUsage{}}
+}
+
+// rollover resets counters at UTC midnight and returns the time of the next reset.
+func (q *quotaTracker) rollover() time.Time {
+	now := q.now().UTC()
+	if day := now.Format(time.DateOnly); day != q.day {
+		q.day = day
+		q.usage = map[string]*clientUsage{}
+	}
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// check reports which budget, if any, client has exhausted and how long until it resets.
+func (q *quotaTracker) check(client string) (string, time.Duration) {
+	if q == nil {
+		return "", 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reset := q.rollover()
+	u := q.usage[client]
+	switch {
+	case u == nil:
+		return "", 0
+	case q.dailyTokens > 0 && u.tokens >= q.dailyTokens:
+		return "tokens", reset.Sub(q.now())
+	case q.dailyCost > 0 && u.cost >= q.dailyCost:
+		return "cost", reset.Sub(q.now())
+	}
+	return "", 0
+}
+
+func (q *quotaTracker) add(client, provider string, usage TokenUsage) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	u := q.usage[client]
+	if u == nil {
+		u = &clientUsage{}
+		q.usage[client] = u
+	}
+	u.tokens += usage.TotalTokens
+	u.cost += float64(usage.TotalTokens) / 1000 * q.prices[provider]
+}
+
+// usageRecorderKey carries the quota middleware's charge function in the request context.
+type usageRecorderKey struct{}
+
+// withUsageRecorder returns a context whose provider calls are charged through record.
+func withUsageRecorder(ctx context.Context, record func(provider string, usage TokenUsage)) context.Context {
+	return context.WithValue(ctx, usageRecorderKey{}, record)
+}
+
+// recordUsage charges tokens a provider reported, whether or not its answer was usable.
+func recordUsage(ctx context.Context, provider string, usage *TokenUsage) {
+	if usage == nil {
+		return
+	}
+	if record, ok := ctx.Value(usageRecorderKey{}).(func(string, TokenUsage)); ok {
+		record(provider, *usage)
+	}
+}
+
+// clientKey identifies the caller for limits: the authenticated principal, else the client IP.
+func clientKey(c *gin.Context) string {
+	if p := principalFrom(c); p != nil {
+		return "principal:" + p.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// parseProxyList parses TRUSTED_PROXIES: comma-separated IPs or CIDRs whose X-Forwarded-For and
+// X-Real-IP headers are believed. Empty trusts no proxy and limits by the connection address.
+func parseProxyList(raw string) ([]string, error) {
+	var out []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("expected an IP or CIDR, got %q", entry)
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// isLLMRoute reports whether the request reaches a model rather than the rules-only mock engine.
+func isLLMRoute(c *gin.Context) bool {
+	return c.FullPath() == "/api/diagnostics/hybrid" || strings.ToLower(c.Param("provider")) != mockProviderName
+}
+
+// limitDiagnostics applies the LLM or rules rate limit to a diagnostics route and, for LLM routes,
+// the daily quota. Every provider call made by the handler is charged as soon as it returns, so
+// answers rejected by schema validation and calls that fell back still count.
+func limitDiagnostics(llm, rules *rateLimiter, quotas *quotaTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := clientKey(c)
+		llmRoute := isLLMRoute(c)
+		limiter := rules
+		if llmRoute {
+			limiter = llm
+		}
+		if ok, wait := limiter.allow(client); !ok {
+			tooManyRequests(c, wait, gin.H{"error": "rate_limited"})
+			return
+		}
+		if llmRoute {
+			if exhausted, wait := quotas.check(client); exhausted != "" {
+				tooManyRequests(c, wait, gin.H{"error": "quota_exceeded", "quota": exhausted})
+				return
+			}
+		}
+
+		c.Request = c.Request.WithContext(withUsageRecorder(c.Request.Context(), func(provider string, usage TokenUsage) {
+			quotas.add(client, provider, usage)
+		}))
+		c.Next()
+	}
+}
+
+func tooManyRequests(c *gin.Context, wait time.Duration, body gin.H) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	body["retryAfter"] = seconds
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, body)
+}
+
+// parsePriceList parses "openai=0.005, gemini=0.0004" (USD per 1K tokens).
+func parsePriceList(raw string) (map[string]float64, error) {
+	out := map[string]float64{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		price, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || price < 0 {
+			return nil, fmt.Errorf("expected provider=price, got %q", entry)
+		}
+		out[strings.ToLower(strings.TrimSpace(name))] = price
+	}
+	return out, nil
+}
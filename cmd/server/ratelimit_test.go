@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRateSpec(t *testing.T) {
+	if spec, err := parseRateSpec("30/m"); err != nil || spec.Count != 30 || spec.Per != time.Minute {
+		t.Fatalf("unexpected spec %+v (%v)", spec, err)
+	}
+	if spec, err := parseRateSpec("0"); err != nil || newRateLimiter(spec) != nil {
+		t.Fatalf("expected 0 to disable limiting, got %+v (%v)", spec, err)
+	}
+	for _, bad := range []string{"30", "30/d", "x/m", "-1/s"} {
+		if _, err := parseRateSpec(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(rateSpec{Count: 2, Per: time.Minute})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != 30*time.Second {
+		t.Fatalf("expected 30s wait after burst, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Fatal("clients must not share buckets")
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatal("expected one request to refill after 30s")
+	}
+}
+
+func TestQuotaTrackerResetsDaily(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	q := newQuotaTracker(0, 0.01, map[string]float64{"openai": 0.005})
+	q.now = func() time.Time { return now }
+
+	q.add("a", "openai", TokenUsage{TotalTokens: 1500})
+	if exhausted, _ := q.check("a"); exhausted != "" {
+		t.Fatalf("expected budget left, got %q", exhausted)
+	}
+	q.add("a", "openai", TokenUsage{TotalTokens: 1000})
+	exhausted, wait := q.check("a")
+	if exhausted != "cost" || wait != time.Hour {
+		t.Fatalf("expected cost quota exhausted until midnight, got %q %v", exhausted, wait)
+	}
+	now = now.Add(time.Hour)
+	if exhausted, _ := q.check("a"); exhausted != "" {
+		t.Fatalf("expected quota reset at UTC midnight, got %q", exhausted)
+	}
+}
+
+func TestDiagnosticsRateLimitAndQuota(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := json.Marshal(map[string]any{"riskLevel": "LOW", "plan": map[string]any{"medication": "Tadalafil"}})
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": string(content)}}},
+			"usage":   map[string]int{"prompt_tokens": 600, "completion_tokens": 400, "total_tokens": 1000},
+		})
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		OpenAIBaseURL:    upstream.URL,
+		RateLimitRules:   rateSpec{Count: 1, Per: time.Minute},
+		QuotaDailyTokens: 1500,
+	})
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("/api/diagnostics/mock"); w.Code != http.StatusOK {
+		t.Fatalf("expected first mock call to pass, got %d", w.Code)
+	}
+	w := post("/api/diagnostics/mock")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected 429 with Retry-After 60, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	for i := 0; i < 2; i++ {
+		w := post("/api/diagnostics/openai")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"totalTokens":1000`) {
+			t.Fatalf("call %d: expected 200 with usage, got %d (%s)", i, w.Code, w.Body.String())
+		}
+	}
+	w = post("/api/diagnostics/hybrid?model=openai")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"quota":"tokens"`) || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected token quota 429, got %d (%s)", w.Code, w.Body.String())
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	post := func(router *gin.Engine, forwarded string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/diagnostics/mock", strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwarded)
+		req.RemoteAddr = "203.0.113.7:41000"
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	router := setupRouter(nil, nil, ".", &Config{RateLimitRules: rateSpec{Count: 1, Per: time.Minute}})
+	if code := post(router, "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected first call to pass, got %d", code)
+	}
+	if code := post(router, "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("a new X-Forwarded-For from an untrusted peer must not reset the bucket, got %d", code)
+	}
+
+	proxied := setupRouter(nil, nil, ".", &Config{
+		RateLimitRules: rateSpec{Count: 1, Per: time.Minute},
+		TrustedProxies: []string{"203.0.113.0/24"},
+	})
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := post(proxied, client); code != http.StatusOK {
+			t.Fatalf("expected clients behind a trusted proxy to get their own buckets, got %d for %s", code, client)
+		}
+	}
+}
+
+func TestParseProxyList(t *testing.T) {
+	if got, err := parseProxyList(" 10.0.0.0/8, 127.0.0.1 ,"); err != nil || strings.Join(got, ",") != "10.0.0.0/8,127.0.0.1" {
+		t.Fatalf("unexpected proxies %v (%v)", got, err)
+	}
+	if _, err := parseProxyList("proxy.internal"); err == nil {
+		t.Fatal("expected error for a host name")
+	}
+}
+
+func TestQuotaChargesRejectedModelOutput(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": `{"riskLevel":"SEVERE"}`}}},
+			"usage":   map[string]int{"prompt_tokens": 900, "completion_tokens": 300, "total_tokens": 1200},
+		})
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		OpenAIBaseURL:    upstream.URL,
+		ProviderFallback: []string{"openai", "mock"},
+		QuotaDailyTokens: 1000,
+		BreakerThreshold: 5,
+	})
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/diagnostics/openai", strings.NewReader(`{"name":"Alex","medications":"tadalafil"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"schema_invalid"`) {
+		t.Fatalf("expected rules fallback after schema failure, got %d (%s)", w.Code, w.Body.String())
+	}
+	if w := post(); w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"quota":"tokens"`) {
+		t.Fatalf("tokens spent on a rejected answer must count against the quota, got %d (%s)", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Review is a clinician's sign-off on an assessment. Reviews are append-only; the latest one holds
+// the plan in effect.
+type Review struct {
+	ID               string       `json:"id"`
+	AssessmentID     string       `json:"assessmentId"`
+	Reviewer         string       `json:"reviewer"`
+	Plan             Plan         `json:"plan"`
+	Confidence       *float64     `json:"confidence,omitempty"`
+	Justification    string       `json:"justification,omitempty"`
+	OverridesBlocker bool         `json:"overridesBlocker"`
+	Diff             []PlanChange `json:"diff"`
+	CreatedAt        time.Time    `json:"createdAt"`
+}
+
+// PlanChange is one field the reviewer changed relative to the plan in effect before the review.
+type PlanChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// ReviewRequest is the body of POST /api/assessments/:id/review.
+type ReviewRequest struct {
+	Reviewer      string   `json:"reviewer"`
+	Plan          Plan     `json:"plan"`
+	Confidence    *float64 `json:"confidence"`
+	Justification string   `json:"justification"`
+}
+
+// currentPlan returns the plan and confidence in effect: the latest review's, else the engine's.
+func (a Assessment) currentPlan() (Plan, float64) {
+	plan, confidence := a.Result.Plan, a.Result.RecommendationConfidence.Plan
+	for _, r := range a.Reviews {
+		plan = r.Plan
+		if r.Confidence != nil {
+			confidence = *r.Confidence
+		}
+	}
+	return plan, confidence
+}
+
+// hasBlocker reports whether the engine output carries a HIGH interaction or contraindication.
+func (a Assessment) hasBlocker() bool {
+	return hasSeverity(a.Result.Interactions, "HIGH") || hasSeverityContra(a.Result.Contraindications, "HIGH")
+}
+
+// newReview validates req against the assessment and builds the review record. Blank plan fields
+// keep their current values. On an assessment with a HIGH blocker, any review whose medication
+// departs from the engine's plan counts as an override and must carry a justification.
+func newReview(a Assessment, req ReviewRequest) (*Review, []validationError) {
+	var errs []validationError
+	before, beforeConf := a.currentPlan()
+
+	review := &Review{
+		ID:            newUUID(),
+		AssessmentID:  a.ID,
+		Reviewer:      strings.TrimSpace(req.Reviewer),
+		Plan:          before,
+		Confidence:    req.Confidence,
+		Justification: strings.TrimSpace(req.Justification),
+		CreatedAt:     time.Now().UTC(),
+	}
+	if review.Reviewer == "" {
+		errs = append(errs, validationError{Field: "reviewer", Message: "Reviewer is required."})
+	}
+	for _, f := range []struct{ value, target *string }{
+		{&req.Plan.Medication, &review.Plan.Medication},
+		{&req.Plan.Dosage, &review.Plan.Dosage},
+		{&req.Plan.Duration, &review.Plan.Duration},
+		{&req.Plan.Rationale, &review.Plan.Rationale},
+	} {
+		if v := strings.TrimSpace(*f.value); v != "" {
+			*f.target = v
+		}
+	}
+	if review.Plan.Medication == "" {
+		errs = append(errs, validationError{Field: "plan.medication", Message: "Plan medication is required."})
+	}
+	if req.Confidence != nil && (*req.Confidence < 0 || *req.Confidence > 1) {
+		errs = append(errs, validationError{Field: "confidence", Message: "Confidence must be between 0 and 1."})
+	}
+
+	review.OverridesBlocker = a.hasBlocker() && !strings.EqualFold(review.Plan.Medication, a.Result.Plan.Medication)
+	if review.OverridesBlocker && review.Justification == "" {
+		errs = append(errs, validationError{Field: "justification", Message: "A justification is required to override a HIGH safety blocker."})
+	}
+
+	review.Diff = diffPlans(before, review.Plan)
+	if req.Confidence != nil && *req.Confidence != beforeConf {
+		review.Diff = append(review.Diff, PlanChange{
+			Field:  "confidence",
+			Before: strconv.FormatFloat(beforeConf, 'f', -1, 64),
+			After:  strconv.FormatFloat(*req.Confidence, 'f', -1, 64),
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return review, nil
+}
+
+func diffPlans(before, after Plan) []PlanChange {
+	changes := []PlanChange{}
+	for _, f := range []struct{ field, before, after string }{
+		{"medication", before.Medication, after.Medication},
+		{"dosage", before.Dosage, after.Dosage},
+		{"duration", before.Duration, after.Duration},
+		{"rationale", before.Rationale, after.Rationale},
+	} {
+		if f.before != f.after {
+			changes = append(changes, PlanChange{Field: f.field, Before: f.before, After: f.after})
+		}
+	}
+	return changes
+}
+
+// recordReview saves a review with its assessment.reviewed audit entry. In Postgres both commit in
+// one transaction; otherwise a failed append is returned after the review was saved.
+func recordReview(ctx context.Context, stores appStores, r *Review) error {
+	return auditedWrite(ctx, stores, auditAssessmentReviewed, r.AssessmentID, func() any { return r }, func(tx pgx.Tx) error {
+		if tx != nil {
+			return insertReview(ctx, tx, r)
+		}
+		return stores.assessments.AddReview(ctx, r)
+	})
+}
+
+func (s *pgAssessmentStore) AddReview(ctx context.Context, r *Review) error {
+	return insertReview(ctx, s.pool, r)
+}
+
+func insertReview(ctx context.Context, db pgExecer, r *Review) error {
+	plan, err := json.Marshal(r.Plan)
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+	diff, err := json.Marshal(r.Diff)
+	if err != nil {
+		return fmt.Errorf("marshal diff: %w", err)
+	}
+	_, err = db.Exec(ctx, `
+		insert into assessment_reviews (id, assessment_id, reviewer, plan, confidence, justification, overrides_blocker, diff, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, r.ID, r.AssessmentID, r.Reviewer, plan, r.Confidence, r.Justification, r.OverridesBlocker, diff, r.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert review: %w", err)
+	}
+	return nil
+}
+
+func (s *pgAssessmentStore) reviews(ctx context.Context, assessmentID string) ([]Review, error) {
+	rows, err := s.pool.Query(ctx, `
+		select id::text, assessment_id::text, reviewer, plan, confidence, justification, overrides_blocker, diff, created_at
+		from assessment_reviews
+		where assessment_id = $1
+		order by created_at, id
+	`, assessmentID)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			// Table not provisioned yet; treat as no data.
+			return []Review{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Review{}
+	for rows.Next() {
+		var r Review
+		var plan, diff []byte
+		if err := rows.Scan(&r.ID, &r.AssessmentID, &r.Reviewer, &plan, &r.Confidence, &r.Justification, &r.OverridesBlocker, &diff, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(plan, &r.Plan); err != nil {
+			return nil, fmt.Errorf("decode review plan: %w", err)
+		}
+		if err := json.Unmarshal(diff, &r.Diff); err != nil {
+			return nil, fmt.Errorf("decode review diff: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
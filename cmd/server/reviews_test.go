@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewReviewDiffAndBlockerOverride(t *testing.T) {
+	a := Assessment{
+		ID: newUUID(),
+		Result: DiagnosticResult{
+			Contraindications: []Contraindication{{ConditionOrAllergy: "Nitrate therapy", Severity: "HIGH"}},
+			Plan:              Plan{Medication: "None", Rationale: "Nitrates present."},
+		},
+	}
+
+	if _, errs := newReview(a, ReviewRequest{Reviewer: "Dr. Smith", Plan: Plan{Medication: "Tadalafil"}}); len(errs) != 1 || errs[0].Field != "justification" {
+		t.Fatalf("expected a justification error when overriding a HIGH blocker, got %+v", errs)
+	}
+
+	conf := 0.6
+	review, errs := newReview(a, ReviewRequest{
+		Reviewer:      "Dr. Smith",
+		Plan:          Plan{Medication: "Tadalafil", Dosage: "2.5mg"},
+		Confidence:    &conf,
+		Justification: "Nitrate discontinued two weeks ago; cardiology cleared.",
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if !review.OverridesBlocker || review.Plan.Rationale != "Nitrates present." {
+		t.Fatalf("unexpected review: %+v", review)
+	}
+	fields := []string{}
+	for _, ch := range review.Diff {
+		fields = append(fields, ch.Field)
+	}
+	if strings.Join(fields, ",") != "medication,dosage,confidence" {
+		t.Fatalf("unexpected diff: %+v", review.Diff)
+	}
+
+	a.Reviews = []Review{*review}
+	second, errs := newReview(a, ReviewRequest{Reviewer: "Dr. Jones", Plan: Plan{Dosage: "5mg"}, Justification: "Agree with prior override."})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if len(second.Diff) != 1 || second.Diff[0].Before != "2.5mg" || second.Diff[0].After != "5mg" {
+		t.Fatalf("expected diff against the latest review, got %+v", second.Diff)
+	}
+}
+
+func TestReviewRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeAssessmentStore{}
+	router := newRouter(nil, nil, ".", &Config{}, appStores{assessments: store})
+	a := newAssessment("mock", "mock", nil, PatientData{Name: "Alex"}, mockAnalyze(PatientData{Medications: "tadalafil"}), time.Now())
+	_ = store.Save(context.Background(), a)
+
+	post := func(id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/assessments/"+id+"/review", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(a.ID, `{"plan":{"medication":"sildenafil"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without a reviewer, got %d", w.Code)
+	}
+	if w := post(newUUID(), `{"reviewer":"Dr. Smith"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown assessment, got %d", w.Code)
+	}
+	w := post(a.ID, `{"reviewer":"Dr. Smith","plan":{"medication":"sildenafil","dosage":"25mg"},"confidence":0.8}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/assessments/"+a.ID, nil)
+	router.ServeHTTP(w, req)
+	var got Assessment
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Reviews) != 1 || got.Reviews[0].Plan.Medication != "sildenafil" || got.Result.Plan.Medication == "sildenafil" {
+		t.Fatalf("expected review alongside the original engine output, got %+v", got)
+	}
+}
+
+func TestReviewRouteSignsAsPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeAssessmentStore{}
+	keys, _ := parseAPIKeys("bob:k-rev=reviewer")
+	router := newRouter(nil, nil, ".", &Config{APIKeys: keys}, appStores{assessments: store})
+	a := newAssessment("mock", "mock", nil, PatientData{Name: "Alex"}, mockAnalyze(PatientData{Medications: "tadalafil"}), time.Now())
+	_ = store.Save(context.Background(), a)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/assessments/"+a.ID+"/review", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(apiKeyHeader, "k-rev")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"reviewer":"Dr. Smith","plan":{"dosage":"5mg"}}`); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "reviewer_mismatch") {
+		t.Fatalf("expected 403 when signing as someone else, got %d (%s)", w.Code, w.Body.String())
+	}
+	w := post(`{"plan":{"dosage":"5mg"}}`)
+	var review Review
+	if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil || w.Code != http.StatusCreated || review.Reviewer != "bob" {
+		t.Fatalf("expected review signed by the principal, got %d (%s)", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed rules/default.yaml
+var defaultRulePackYAML []byte
+
+// RulePack is the versioned, on-disk definition of the safety engine.
+type RulePack struct {
+	Version        string         `json:"version" yaml:"version"`
+	SeverityWeight map[string]int `json:"severityWeight" yaml:"severityWeight"`
+	Rules          []Rule         `json:"rules" yaml:"rules"`
+}
+
+type Rule struct {
+	ID         string    `json:"id" yaml:"id"`
+	Type       string    `json:"type" yaml:"type"` // interaction|contra|dosing
+	Severity   string    `json:"severity" yaml:"severity"`
+	Label      string    `json:"label,omitempty" yaml:"label"`
+	Group      string    `json:"group,omitempty" yaml:"group"` // first matching rule in a group wins
+	Match      RuleMatch `json:"match" yaml:"match"`
+	Note       string    `json:"note" yaml:"note"`
+	ReduceDose bool      `json:"reduceDose,omitempty" yaml:"reduceDose"`
+	Rationale  string    `json:"rationale,omitempty" yaml:"rationale"`
+	References []string  `json:"references,omitempty" yaml:"references"` // evidence shown with the finding
+}
+
+type RuleMatch struct {
+	DrugClassA        string  `json:"drugClassA,omitempty" yaml:"drugClassA"`
+	DrugClassB        string  `json:"drugClassB,omitempty" yaml:"drugClassB"`
+	Condition         string  `json:"condition,omitempty" yaml:"condition"`
+	RequiresDrugClass string  `json:"requiresDrugClass,omitempty" yaml:"requiresDrugClass"`
+	AllergyClass      string  `json:"allergyClass,omitempty" yaml:"allergyClass"`
+	MinAge            int     `json:"minAge,omitempty" yaml:"minAge"`
+	MinSystolic       float64 `json:"minSystolic,omitempty" yaml:"minSystolic"`
+	MinDiastolic      float64 `json:"minDiastolic,omitempty" yaml:"minDiastolic"`
+	MinBMI            float64 `json:"minBMI,omitempty" yaml:"minBMI"`
+	Smoking           string  `json:"smoking,omitempty" yaml:"smoking"`
+	Alcohol           string  `json:"alcohol,omitempty" yaml:"alcohol"`
+	Exercise          string  `json:"exercise,omitempty" yaml:"exercise"`
+	Drug              string  `json:"drug,omitempty" yaml:"drug"`           // generic from the drug class registry
+	MaxDoseMg         float64 `json:"maxDoseMg,omitempty" yaml:"maxDoseMg"` // fires when the daily dose of drug exceeds this ceiling
+}
+
+// MatchedInput is a patient input that met one criterion of a rule, e.g. the medication
+// "imdur 30mg" meeting drugClassA: nitrates via isosorbide mononitrate.
+type MatchedInput struct {
+	Field     string `json:"field"`
+	Input     string `json:"input"`
+	Criterion string `json:"criterion"`
+	Via       string `json:"via,omitempty"` // the generic the input resolved to, when it differs
+}
+
+// RuleTrace is one rule's outcome in an explained evaluation. Rules that did not fire carry the
+// first criterion that failed.
+type RuleTrace struct {
+	RuleID    string         `json:"ruleId"`
+	Type      string         `json:"type"`
+	Severity  string         `json:"severity"`
+	Fired     bool           `json:"fired"`
+	MatchedOn []MatchedInput `json:"matchedOn,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+}
+
+// RuleExplanation is the full rule pack evaluation returned with explain=true.
+type RuleExplanation struct {
+	RulePackVersion string      `json:"rulePackVersion"`
+	RulePackHash    string      `json:"rulePackHash"`
+	Rules           []RuleTrace `json:"rules"`
+}
+
+// patientFacts is the normalized view of PatientData that rules match against.
+type patientFacts struct {
+	meds        []string
+	medOrigin   map[string]string // ingredient added for a combination product -> entry as given
+	medSigs     []MedicationSig
+	allergies   []string
+	conditions  []string
+	age         int
+	bpSystolic  float64
+	bpDiastolic float64
+	bmi         float64
+	smoking     string
+	alcohol     string
+	exercise    string
+}
+
+// loadedRulePack is a validated pack plus the provenance reported by GET /api/rules.
+type loadedRulePack struct {
+	Pack     *RulePack `json:"pack"`
+	Version  string    `json:"version"`
+	Hash     string    `json:"hash"`
+	Source   string    `json:"source"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// activeRules holds the pack used by the safety engine. It is swapped atomically on reload so
+// in-flight evaluations keep the pack they started with.
+var activeRules atomic.Pointer[loadedRulePack]
+
+func init() {
+	loaded, err := loadRulePack("")
+	if err != nil {
+		panic(err)
+	}
+	activeRules.Store(loaded)
+}
+
+func currentRulePack() *RulePack {
+	return activeRules.Load().Pack
+}
+
+// rulePackKey carries the pack a request captured, so everything it evaluates and records uses one
+// version even when a reload lands mid-request.
+type rulePackKey struct{}
+
+func withRulePack(ctx context.Context, rules *loadedRulePack) context.Context {
+	return context.WithValue(ctx, rulePackKey{}, rules)
+}
+
+// rulePackFrom returns the pack captured in ctx, else the active pack.
+func rulePackFrom(ctx context.Context) *RulePack {
+	if rules, ok := ctx.Value(rulePackKey{}).(*loadedRulePack); ok && rules != nil {
+		return rules.Pack
+	}
+	return currentRulePack()
+}
+
+// loadRulePack reads and validates a rule pack from disk. An empty path yields the bundled default pack.
+func loadRulePack(path string) (*loadedRulePack, error) {
+	raw, source := defaultRulePackYAML, "embedded:default.yaml"
+	if path != "" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read rule pack: %w", err)
+		}
+		source = path
+	}
+
+	pack, err := parseRulePack(raw, filepath.Base(source))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &loadedRulePack{
+		Pack:     pack,
+		Version:  pack.Version,
+		Hash:     "sha256:" + hex.EncodeToString(sum[:]),
+		Source:   source,
+		LoadedAt: time.Now().UTC(),
+	}, nil
+}
+
+// reloadRulePack swaps in the pack at path when it is valid and differs from the active one.
+// An invalid pack is rejected and the previous pack stays live.
+func reloadRulePack(path string) (bool, error) {
+	loaded, err := loadRulePack(path)
+	if err != nil {
+		return false, err
+	}
+	if current := activeRules.Load(); current != nil && current.Hash == loaded.Hash {
+		return false, nil
+	}
+	activeRules.Store(loaded)
+	return true, nil
+}
+
+// watchRulePack reloads the pack on SIGHUP and whenever the file's modification time changes.
+func watchRulePack(ctx context.Context, path string, interval time.Duration, onReload func(r *loadedRulePack, reason string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastMod := modTime(path)
+	reload := func(reason string) {
+		changed, err := reloadRulePack(path)
+		if err != nil {
+			log.Printf("rule pack reload (%s) rejected, keeping version %s: %v", reason, currentRulePack().Version, err)
+			return
+		}
+		if changed {
+			active := activeRules.Load()
+			log.Printf("rule pack reloaded (%s): version %s, %s", reason, active.Version, active.Hash)
+			if onReload != nil {
+				onReload(active, reason)
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			lastMod = modTime(path)
+			reload("sighup")
+		case <-tick:
+			if mod := modTime(path); !mod.Equal(lastMod) {
+				lastMod = mod
+				reload("file change")
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func parseRulePack(raw []byte, name string) (*RulePack, error) {
+	var pack RulePack
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&pack); err != nil {
+			return nil, fmt.Errorf("decode rule pack %s: %w", name, err)
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(&pack); err != nil {
+			return nil, fmt.Errorf("decode rule pack %s: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rule pack format %q (want .json, .yaml or .yml)", filepath.Ext(name))
+	}
+
+	if len(pack.SeverityWeight) == 0 {
+		pack.SeverityWeight = map[string]int{"HIGH": 40, "MEDIUM": 20, "LOW": 10}
+	}
+	if errs := validateRulePack(&pack); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rule pack %s: %s", name, strings.Join(errs, "; "))
+	}
+	return &pack, nil
+}
+
+func validateRulePack(pack *RulePack) []string {
+	var errs []string
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(pack.Version) == "" {
+		add("version is required")
+	}
+	for _, sev := range []string{"HIGH", "MEDIUM", "LOW"} {
+		if _, ok := pack.SeverityWeight[sev]; !ok {
+			add("severityWeight missing %s", sev)
+		}
+	}
+	if len(pack.Rules) == 0 {
+		add("at least one rule is required")
+	}
+
+	seen := make(map[string]bool, len(pack.Rules))
+	for i, rule := range pack.Rules {
+		ref := fmt.Sprintf("rules[%d]", i)
+		if rule.ID == "" {
+			add("%s: id is required", ref)
+		} else {
+			ref = fmt.Sprintf("rule %q", rule.ID)
+			if seen[rule.ID] {
+				add("%s: duplicate id", ref)
+			}
+			seen[rule.ID] = true
+		}
+		if _, ok := pack.SeverityWeight[rule.Severity]; !ok {
+			add("%s: unknown severity %q", ref, rule.Severity)
+		}
+
+		m := rule.Match
+		for _, class := range []string{m.DrugClassA, m.DrugClassB, m.RequiresDrugClass, m.AllergyClass} {
+			if class != "" && !knownDrugClass(class) {
+				add("%s: unknown drug class %q", ref, class)
+			}
+		}
+		if m.Drug != "" && !drugClasses.Load().hasGeneric(m.Drug) {
+			add("%s: unknown drug %q", ref, m.Drug)
+		}
+		if m.MaxDoseMg < 0 {
+			add("%s: maxDoseMg must be positive", ref)
+		}
+		if m.MaxDoseMg > 0 && (m.Drug == "" || rule.Type != "dosing") {
+			add("%s: maxDoseMg is only valid on dosing rules with a drug", ref)
+		}
+		switch rule.Type {
+		case "interaction":
+			if m.DrugClassA == "" || m.DrugClassB == "" {
+				add("%s: interaction rules need drugClassA and drugClassB", ref)
+			}
+		case "contra", "dosing":
+			if m == (RuleMatch{}) {
+				add("%s: match has no criteria", ref)
+			}
+		default:
+			add("%s: unknown type %q", ref, rule.Type)
+		}
+	}
+	return errs
+}
+
+func newPatientFacts(data PatientData) patientFacts {
+	meds, origin := withIngredients(normalizeList(data.Medications))
+	return patientFacts{
+		meds:        meds,
+		medOrigin:   origin,
+		medSigs:     data.ParsedMedications(),
+		allergies:   normalizeList(data.Allergies),
+		conditions:  lowerSlice(data.Conditions),
+		age:         data.Age,
+		bpSystolic:  data.BPSystolic,
+		bpDiastolic: data.BPDiastolic,
+		bmi:         data.BMI,
+		smoking:     strings.ToLower(strings.TrimSpace(data.Smoking)),
+		alcohol:     strings.ToLower(strings.TrimSpace(data.Alcohol)),
+		exercise:    strings.ToLower(strings.TrimSpace(data.Exercise)),
+	}
+}
+
+// matches reports whether every populated criterion of the rule holds for the patient.
+func (m RuleMatch) matches(f patientFacts) bool {
+	_, failed := m.evaluate(f)
+	return failed == ""
+}
+
+// evaluate checks every populated criterion against the patient. It returns the inputs that met
+// them, or a description of the first criterion that did not hold.
+func (m RuleMatch) evaluate(f patientFacts) ([]MatchedInput, string) {
+	var matched []MatchedInput
+	hit := func(field, input, criterion, via string) {
+		in := MatchedInput{Field: field, Input: input, Criterion: criterion}
+		if via != input {
+			in.Via = via
+		}
+		matched = append(matched, in)
+	}
+	class := func(field string, tokens []string, criterion, className string) bool {
+		token, generic, ok := drugClasses.Load().match(tokens, className)
+		if ok {
+			input := token
+			if orig, added := f.medOrigin[token]; added && field == "medications" {
+				input = orig
+			}
+			hit(field, input, criterion+": "+className, generic)
+		}
+		return ok
+	}
+
+	if m.DrugClassA != "" && !class("medications", f.meds, "drugClassA", m.DrugClassA) {
+		return nil, "no medication in class " + m.DrugClassA
+	}
+	if m.DrugClassB != "" && !class("medications", f.meds, "drugClassB", m.DrugClassB) {
+		return nil, "no medication in class " + m.DrugClassB
+	}
+	if m.RequiresDrugClass != "" && !class("medications", f.meds, "requiresDrugClass", m.RequiresDrugClass) {
+		return nil, "no medication in class " + m.RequiresDrugClass
+	}
+	if m.AllergyClass != "" && !class("allergies", f.allergies, "allergyClass", m.AllergyClass) {
+		return nil, "no allergy in class " + m.AllergyClass
+	}
+	if m.Condition != "" {
+		condition := strings.ToLower(m.Condition)
+		if !containsString(f.conditions, condition) {
+			return nil, "condition " + condition + " not reported"
+		}
+		hit("conditions", condition, "condition: "+condition, "")
+	}
+	if m.MinAge > 0 {
+		if f.age < m.MinAge {
+			return nil, fmt.Sprintf("age %d below %d", f.age, m.MinAge)
+		}
+		hit("age", strconv.Itoa(f.age), fmt.Sprintf("minAge: %d", m.MinAge), "")
+	}
+	if m.MinSystolic > 0 || m.MinDiastolic > 0 {
+		sysHit := m.MinSystolic > 0 && f.bpSystolic >= m.MinSystolic
+		diaHit := m.MinDiastolic > 0 && f.bpDiastolic >= m.MinDiastolic
+		bp := fmt.Sprintf("%g/%g", f.bpSystolic, f.bpDiastolic)
+		if !sysHit && !diaHit {
+			return nil, fmt.Sprintf("blood pressure %s below %g/%g", bp, m.MinSystolic, m.MinDiastolic)
+		}
+		hit("bloodPressure", bp, fmt.Sprintf("minSystolic: %g or minDiastolic: %g", m.MinSystolic, m.MinDiastolic), "")
+	}
+	if m.MinBMI > 0 {
+		if f.bmi < m.MinBMI {
+			return nil, fmt.Sprintf("BMI %.1f below %g", f.bmi, m.MinBMI)
+		}
+		hit("bmi", fmt.Sprintf("%.1f", f.bmi), fmt.Sprintf("minBMI: %g", m.MinBMI), "")
+	}
+	for _, lifestyle := range []struct{ field, want, got string }{
+		{"smoking", m.Smoking, f.smoking},
+		{"alcohol", m.Alcohol, f.alcohol},
+		{"exercise", m.Exercise, f.exercise},
+	} {
+		if lifestyle.want == "" {
+			continue
+		}
+		want := strings.ToLower(lifestyle.want)
+		if lifestyle.got != want {
+			return nil, fmt.Sprintf("%s is %q, not %q", lifestyle.field, lifestyle.got, want)
+		}
+		hit(lifestyle.field, lifestyle.got, lifestyle.field+": "+want, "")
+	}
+	if m.MaxDoseMg > 0 {
+		sig, _, ok := f.dosedAbove(m.Drug, m.MaxDoseMg)
+		if !ok {
+			return nil, fmt.Sprintf("no %s daily dose above %smg", m.Drug, formatMg(m.MaxDoseMg))
+		}
+		hit("medications", sig.Raw, fmt.Sprintf("drug: %s, maxDoseMg: %s", m.Drug, formatMg(m.MaxDoseMg)), sig.Generic)
+	} else if m.Drug != "" {
+		sig, ok := f.taking(m.Drug)
+		if !ok {
+			return nil, "not taking " + m.Drug
+		}
+		hit("medications", sig.Raw, "drug: "+m.Drug, sig.Generic)
+	}
+	return matched, ""
+}
+
+// taking returns the first parsed medication that resolves to generic.
+func (f patientFacts) taking(generic string) (MedicationSig, bool) {
+	for _, sig := range f.medSigs {
+		if sig.Generic == generic {
+			return sig, true
+		}
+	}
+	return MedicationSig{}, false
+}
+
+// dosedAbove returns the first parsed medication of generic whose daily total (strength times
+// doses per day) exceeds maxMg, along with that total.
+func (f patientFacts) dosedAbove(generic string, maxMg float64) (MedicationSig, float64, bool) {
+	for _, sig := range f.medSigs {
+		if sig.Generic != generic {
+			continue
+		}
+		if mg, ok := sig.dailyMg(); ok && mg > maxMg {
+			return sig, mg, true
+		}
+	}
+	return MedicationSig{}, 0, false
+}
+
+// evaluate traces every rule against the patient, honouring group exclusivity. Traces are in
+// pack order, one per rule.
+func (p *RulePack) evaluate(f patientFacts) []RuleTrace {
+	traces := make([]RuleTrace, 0, len(p.Rules))
+	groupsHit := make(map[string]string)
+	for _, rule := range p.Rules {
+		trace := RuleTrace{RuleID: rule.ID, Type: rule.Type, Severity: rule.Severity}
+		if winner, ok := groupsHit[rule.Group]; ok && rule.Group != "" {
+			trace.Reason = fmt.Sprintf("group %s already fired by %s", rule.Group, winner)
+		} else if trace.MatchedOn, trace.Reason = rule.Match.evaluate(f); trace.Reason == "" {
+			trace.Fired = true
+			if rule.Group != "" {
+				groupsHit[rule.Group] = rule.ID
+			}
+		}
+		traces = append(traces, trace)
+	}
+	return traces
+}
+
+// firedRules returns the rules that match the patient, honouring group exclusivity.
+func (p *RulePack) firedRules(f patientFacts) []Rule {
+	var fired []Rule
+	for i, trace := range p.evaluate(f) {
+		if trace.Fired {
+			fired = append(fired, p.Rules[i])
+		}
+	}
+	return fired
+}
+
+// explainRules evaluates the pack against data and returns the trace of every rule.
+func explainRules(loaded *loadedRulePack, data PatientData) *RuleExplanation {
+	return &RuleExplanation{
+		RulePackVersion: loaded.Version,
+		RulePackHash:    loaded.Hash,
+		Rules:           loaded.Pack.evaluate(newPatientFacts(data)),
+	}
+}
+
+func (r Rule) label() string {
+	if r.Label != "" {
+		return r.Label
+	}
+	if r.Type == "interaction" {
+		return fmt.Sprintf("%s+%s", r.Match.DrugClassA, r.Match.DrugClassB)
+	}
+	if r.Match.Condition != "" {
+		return r.Match.Condition
+	}
+	return r.ID
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDefaultRulePackIsValid(t *testing.T) {
+	loaded, err := loadRulePack("")
+	if err != nil {
+		t.Fatalf("default rule pack failed to load: %v", err)
+	}
+	if loaded.Version == "" || len(loaded.Pack.Rules) == 0 || !strings.HasPrefix(loaded.Hash, "sha256:") {
+		t.Fatalf("expected versioned, hashed pack with rules, got %+v", loaded)
+	}
+}
+
+func TestLoadRulePackFromJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	body := `{
+		"version": "test-1",
+		"rules": [
+			{"id": "nitrates+pde5i", "type": "interaction", "severity": "HIGH", "label": "Nitrates + PDE5i",
+			 "match": {"drugClassA": "nitrates", "drugClassB": "pde5i"}, "note": "custom note"}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadRulePack(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pack := loaded.Pack
+	if pack.SeverityWeight["HIGH"] != 40 {
+		t.Fatalf("expected default severity weights, got %v", pack.SeverityWeight)
+	}
+
+	result := evaluateRulePack(pack, PatientData{Medications: "sildenafil, isosorbide mononitrate"})
+	if len(result.Interactions) != 1 || result.Interactions[0].Note != "custom note" {
+		t.Fatalf("expected only the pack's interaction, got %+v", result.Interactions)
+	}
+	if len(result.Contraindications) != 0 {
+		t.Fatalf("expected no hard-coded contraindications, got %+v", result.Contraindications)
+	}
+}
+
+func TestLoadRulePackRejectsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown class":    `{"version":"x","rules":[{"id":"a","type":"interaction","severity":"HIGH","match":{"drugClassA":"statins","drugClassB":"pde5i"}}]}`,
+		"duplicate id":     `{"version":"x","rules":[{"id":"a","type":"dosing","severity":"LOW","match":{"minAge":60}},{"id":"a","type":"dosing","severity":"LOW","match":{"minAge":70}}]}`,
+		"unknown severity": `{"version":"x","rules":[{"id":"a","type":"dosing","severity":"SEVERE","match":{"minAge":60}}]}`,
+		"empty match":      `{"version":"x","rules":[{"id":"a","type":"contra","severity":"LOW","match":{}}]}`,
+		"missing version":  `{"rules":[{"id":"a","type":"dosing","severity":"LOW","match":{"minAge":60}}]}`,
+		"unknown field":    `{"version":"x","rules":[{"id":"a","type":"dosing","severity":"LOW","match":{"maxAge":60}}]}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseRulePack([]byte(body), "rules.json"); err == nil {
+				t.Fatalf("expected error for %s", name)
+			}
+		})
+	}
+}
+
+func TestRuleGroupsFireOnce(t *testing.T) {
+	result := mockAnalyze(PatientData{BPSystolic: 180, BPDiastolic: 115, BMI: 40})
+	var bp, bmi int
+	for _, c := range result.Contraindications {
+		if strings.Contains(c.ConditionOrAllergy, "BP") {
+			bp++
+		}
+	}
+	for _, d := range result.DosingConcerns {
+		if strings.Contains(d.Factor, "BMI") {
+			bmi++
+		}
+	}
+	if bp != 1 || bmi != 1 {
+		t.Fatalf("expected one BP and one BMI finding, got %d and %d", bp, bmi)
+	}
+}
+
+func TestNitratePDE5iInteractionNotDuplicated(t *testing.T) {
+	result := mockAnalyze(PatientData{Medications: "tadalafil, nitroglycerin"})
+	if len(result.Interactions) != 1 {
+		t.Fatalf("expected a single nitrate interaction, got %+v", result.Interactions)
+	}
+}
+
+func TestReloadRulePackKeepsPreviousOnError(t *testing.T) {
+	previous := activeRules.Load()
+	t.Cleanup(func() { activeRules.Store(previous) })
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	good := "version: v2\nrules:\n  - {id: age, type: dosing, severity: LOW, match: {minAge: 50}, note: custom}\n"
+	if err := os.WriteFile(path, []byte(good), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := reloadRulePack(path); err != nil || !changed {
+		t.Fatalf("expected reload to succeed, changed=%v err=%v", changed, err)
+	}
+	if changed, err := reloadRulePack(path); err != nil || changed {
+		t.Fatalf("expected identical pack to be a no-op, changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte("version: v3\nrules:\n  - {id: bad, type: dosing, severity: NOPE, match: {minAge: 50}}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadRulePack(path); err == nil {
+		t.Fatal("expected invalid pack to be rejected")
+	}
+	if v := currentRulePack().Version; v != "v2" {
+		t.Fatalf("expected v2 to stay live, got %s", v)
+	}
+}
+
+func TestMockProviderUsesCapturedRulePack(t *testing.T) {
+	pack, err := parseRulePack([]byte("version: v9\nrules:\n  - {id: age, type: dosing, severity: LOW, label: Captured pack, match: {minAge: 50}, note: custom}\n"), "rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	captured := &loadedRulePack{Pack: pack, Version: pack.Version}
+	// The active pack differs from the captured one, as after a reload mid-request.
+	ctx := withRulePack(context.Background(), captured)
+
+	result, err := mockProvider{}.Analyze(ctx, PatientData{Age: 60})
+	if err != nil || len(result.DosingConcerns) != 1 || result.DosingConcerns[0].RuleID != "age" {
+		t.Fatalf("expected the captured pack to be evaluated, got %+v (%v)", result.DosingConcerns, err)
+	}
+}
+
+func TestRulesEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/rules", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Version  string    `json:"version"`
+		Hash     string    `json:"hash"`
+		LoadedAt string    `json:"loadedAt"`
+		Pack     *RulePack `json:"pack"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse rules response: %v", err)
+	}
+	if resp.Version == "" || resp.Hash == "" || resp.LoadedAt == "" || resp.Pack == nil || len(resp.Pack.Rules) == 0 {
+		t.Fatalf("unexpected rules response: %s", w.Body.String())
+	}
+}
+
+func TestDoseCeilingRules(t *testing.T) {
+	result := mockAnalyze(PatientData{
+		Conditions:        []string{"Kidney Disease"},
+		Medications:       "Cialis",
+		MedicationDetails: "tadalafil | 20mg | daily",
+	})
+	var found *DosingConcern
+	for i, d := range result.DosingConcerns {
+		if strings.Contains(d.Factor, "renal dose cap") {
+			found = &result.DosingConcerns[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected renal tadalafil cap finding, got %+v", result.DosingConcerns)
+	}
+	if found.ObservedDose != "tadalafil 20mg" || found.MaxDose != "tadalafil 5mg" || !strings.Contains(found.Recommendation, "Observed tadalafil 20mg") {
+		t.Fatalf("expected observed vs max dose, got %+v", found)
+	}
+	if result.RiskLevel != "HIGH" {
+		t.Fatalf("expected HIGH risk for renal cap exceedance, got %s", result.RiskLevel)
+	}
+
+	withinCap := mockAnalyze(PatientData{Conditions: []string{"kidney disease"}, Medications: "tadalafil 5mg daily"})
+	if containsIssue(withinCap.Issues, "renal dose cap") {
+		t.Fatalf("dose at the cap must not fire, got %+v", withinCap.Issues)
+	}
+
+	twiceDaily := mockAnalyze(PatientData{Conditions: []string{"kidney disease"}, Medications: "Tadalafil 5mg twice daily"})
+	found = nil
+	for i, d := range twiceDaily.DosingConcerns {
+		if strings.Contains(d.Factor, "renal dose cap") {
+			found = &twiceDaily.DosingConcerns[i]
+		}
+	}
+	if found == nil || found.ObservedDose != "tadalafil 10mg/day (5mg twice daily)" || found.MaxDose != "tadalafil 5mg" {
+		t.Fatalf("expected the 10mg daily total to exceed the 5mg cap, got %+v", twiceDaily.DosingConcerns)
+	}
+}
+
+func TestDosesPerDay(t *testing.T) {
+	cases := map[string]float64{
+		"tadalafil 5mg daily":     1,
+		"tadalafil 5mg bid":       2,
+		"sildenafil 20mg tid":     3,
+		"sildenafil 20mg q8h":     3,
+		"morphine 5mg q5h":        5,
+		"alendronate 70mg weekly": 1,
+		"sildenafil 50mg prn":     1,
+	}
+	for entry, want := range cases {
+		sig, _ := parseMedicationSig(entry)
+		if got := sig.dosesPerDay(); got != want {
+			t.Errorf("%q: got %v doses per day, want %v", entry, got, want)
+		}
+	}
+}
+
+func TestSildenafilStartDoseGroupFiresOnce(t *testing.T) {
+	result := mockAnalyze(PatientData{Age: 70, Medications: "sildenafil 50mg prn, clarithromycin 500mg bid"})
+	count := 0
+	for _, d := range result.DosingConcerns {
+		if strings.Contains(d.Factor, "Sildenafil above") {
+			count++
+			if d.ObservedDose != "sildenafil 50mg" || d.MaxDose != "sildenafil 25mg" {
+				t.Fatalf("unexpected dose details: %+v", d)
+			}
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected exactly one sildenafil start-dose finding, got %d: %+v", count, result.DosingConcerns)
+	}
+}
+
+func TestDoseRuleValidation(t *testing.T) {
+	bad := []string{
+		`{"version":"x","rules":[{"id":"a","type":"dosing","severity":"LOW","match":{"drug":"unobtainium","maxDoseMg":5}}]}`,
+		`{"version":"x","rules":[{"id":"a","type":"dosing","severity":"LOW","match":{"condition":"x","maxDoseMg":5}}]}`,
+		`{"version":"x","rules":[{"id":"a","type":"contra","severity":"LOW","match":{"drug":"tadalafil","maxDoseMg":5}}]}`,
+	}
+	for _, body := range bad {
+		if _, err := parseRulePack([]byte(body), "rules.json"); err == nil {
+			t.Fatalf("expected validation error for %s", body)
+		}
+	}
+}
+
+func TestFindingsCarryRuleIDAndMatchedInputs(t *testing.T) {
+	result := mockAnalyze(PatientData{Medications: "Imdur 30mg, Paxlovid, cialis 5mg"})
+	byID := map[string]Interaction{}
+	for _, in := range result.Interactions {
+		byID[in.RuleID] = in
+	}
+
+	nitrates := byID["nitrates+pde5i"]
+	if len(nitrates.MatchedOn) != 2 || len(nitrates.Evidence) == 0 {
+		t.Fatalf("expected matched inputs and evidence, got %+v", nitrates)
+	}
+	if got := nitrates.MatchedOn[0]; got != (MatchedInput{Field: "medications", Input: "imdur 30mg", Criterion: "drugClassA: nitrates", Via: "isosorbide mononitrate"}) {
+		t.Fatalf("unexpected nitrate match %+v", got)
+	}
+	if got := byID["cyp3a4+pde5i"].MatchedOn[0]; got.Input != "paxlovid" || got.Via != "ritonavir" {
+		t.Fatalf("expected the combination product as input, got %+v", got)
+	}
+	if len(result.Contraindications) == 0 || result.Contraindications[0].RuleID != "nitrate-therapy" {
+		t.Fatalf("expected contraindications to carry rule ids, got %+v", result.Contraindications)
+	}
+}
+
+func TestDiagnosticsExplainTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter(nil, nil, ".", &Config{}, appStores{})
+	body := `{"name":"Alex","age":40,"weight":80,"height":180,"medications":"tadalafil","bpSystolic":180,"bpDiastolic":115,"conditions":["hypertension"]}`
+
+	for query, wantTrace := range map[string]bool{"": false, "?explain=true": true} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/diagnostics/mock"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+		}
+		var result DiagnosticResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if (result.Explain != nil) != wantTrace {
+			t.Fatalf("query %q: explain present = %v", query, result.Explain != nil)
+		}
+		if !wantTrace {
+			continue
+		}
+
+		traces := map[string]RuleTrace{}
+		for _, tr := range result.Explain.Rules {
+			traces[tr.RuleID] = tr
+		}
+		if len(result.Explain.Rules) != len(currentRulePack().Rules) || result.Explain.RulePackVersion == "" {
+			t.Fatalf("expected a trace for every rule, got %+v", result.Explain)
+		}
+		if tr := traces["bp-severe"]; !tr.Fired || tr.MatchedOn[0].Field != "bloodPressure" {
+			t.Fatalf("expected bp-severe to fire on blood pressure, got %+v", tr)
+		}
+		if tr := traces["bp-elevated"]; tr.Fired || tr.Reason != "group blood-pressure already fired by bp-severe" {
+			t.Fatalf("expected group exclusivity to be explained, got %+v", tr)
+		}
+		if tr := traces["nitrates+pde5i"]; tr.Fired || tr.Reason != "no medication in class nitrates" {
+			t.Fatalf("expected the failing criterion, got %+v", tr)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultRxNavCacheSize = 1000
+	defaultRxNavCacheTTL  = 24 * time.Hour
+	// cacheLoadTimeout bounds a shared load, which outlives the callers that started it.
+	cacheLoadTimeout = 30 * time.Second
+
+	cacheKindRXCUI        = "rxcui"
+	cacheKindInteractions = "interactions"
+)
+
+// CacheStats counts lookups through one cache. Shared lookups waited on an identical in-flight
+// lookup instead of calling upstream; BackendHits were misses served from the Postgres table.
+type CacheStats struct {
+	Size        int   `json:"size"`
+	Capacity    int   `json:"capacity"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Shared      int64 `json:"shared"`
+	BackendHits int64 `json:"backendHits"`
+	Evictions   int64 `json:"evictions"`
+	Expired     int64 `json:"expired"`
+}
+
+// cacheBackend is a shared second tier behind the in-process LRU.
+type cacheBackend interface {
+	Get(ctx context.Context, kind, key string) ([]byte, bool, error)
+	Set(ctx context.Context, kind, key string, value []byte, expiresAt time.Time) error
+}
+
+// lruCache is an in-process LRU with a TTL per entry. Concurrent misses for the same key share
+// one load. Only successful loads are cached.
+type lruCache[V any] struct {
+	kind        string
+	capacity    int
+	ttl         time.Duration
+	loadTimeout time.Duration
+	backend     cacheBackend
+	now         func() time.Time
+	group       singleflight.Group
+
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+type cacheEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// newLRUCache returns nil when capacity is zero, which disables caching.
+func newLRUCache[V any](kind string, capacity int, ttl time.Duration, backend cacheBackend) *lruCache[V] {
+	if capacity <= 0 {
+		return nil
+	}
+	return &lruCache[V]{
+		kind:        kind,
+		capacity:    capacity,
+		ttl:         ttl,
+		loadTimeout: cacheLoadTimeout,
+		backend:     backend,
+		now:         time.Now,
+		order:       list.New(),
+		items:       map[string]*list.Element{},
+		stats:       CacheStats{Capacity: capacity},
+	}
+}
+
+// get returns the cached value for key or loads it. A caller whose context ends while waiting on
+// a shared load gets its context error; the load itself carries on for the others.
+func (c *lruCache[V]) get(ctx context.Context, key string, load func(context.Context) (V, error)) (V, error) {
+	if c == nil {
+		return load(ctx)
+	}
+	if v, ok := c.lookup(key); ok {
+		return v, nil
+	}
+
+	ch := c.group.DoChan(key, func() (any, error) {
+		// Detached so one caller going away does not fail everyone sharing the load, but still
+		// bounded so a hung upstream or backend cannot pin the key forever.
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+		if v, ok := c.fromBackend(loadCtx, key); ok {
+			return v, nil
+		}
+		v, err := load(loadCtx)
+		if err != nil {
+			return v, err
+		}
+		c.store(loadCtx, key, v)
+		return v, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			c.count(func(s *CacheStats) { s.Shared++ })
+		}
+		v, _ := res.Val.(V)
+		return v, res.Err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (c *lruCache[V]) lookup(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return zero, false
+	}
+	entry := el.Value.(*cacheEntry[V])
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.stats.Expired++
+		c.stats.Misses++
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+func (c *lruCache[V]) fromBackend(ctx context.Context, key string) (V, bool) {
+	var v V
+	if c.backend == nil {
+		return v, false
+	}
+	raw, ok, err := c.backend.Get(ctx, c.kind, key)
+	if err != nil {
+		log.Printf("%s cache backend read failed: %v", c.kind, err)
+		return v, false
+	}
+	if !ok || json.Unmarshal(raw, &v) != nil {
+		return v, false
+	}
+	c.count(func(s *CacheStats) { s.BackendHits++ })
+	c.put(key, v)
+	return v, true
+}
+
+func (c *lruCache[V]) store(ctx context.Context, key string, v V) {
+	expiresAt := c.put(key, v)
+	if c.backend == nil {
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = c.backend.Set(ctx, c.kind, key, raw, expiresAt)
+	}
+	if err != nil {
+		log.Printf("%s cache backend write failed: %v", c.kind, err)
+	}
+}
+
+// put inserts or refreshes key and evicts the least recently used entry when over capacity.
+func (c *lruCache[V]) put(key string, v V) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		el.Value = &cacheEntry[V]{key: key, value: v, expiresAt: expiresAt}
+		c.order.MoveToFront(el)
+		return expiresAt
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry[V]{key: key, value: v, expiresAt: expiresAt})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry[V]).key)
+		c.stats.Evictions++
+	}
+	return expiresAt
+}
+
+func (c *lruCache[V]) count(update func(*CacheStats)) {
+	c.mu.Lock()
+	update(&c.stats)
+	c.mu.Unlock()
+}
+
+func (c *lruCache[V]) snapshot() *CacheStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.order.Len()
+	return &s
+}
+
+// rxnavCaches holds the caches in front of the two RxNav calls.
+type rxnavCaches struct {
+	rxcui        *lruCache[string]
+	interactions *lruCache[[]Interaction]
+}
+
+func newRxNavCaches(capacity int, ttl time.Duration, backend cacheBackend) *rxnavCaches {
+	return &rxnavCaches{
+		rxcui:        newLRUCache[string](cacheKindRXCUI, capacity, ttl, backend),
+		interactions: newLRUCache[[]Interaction](cacheKindInteractions, capacity, ttl, backend),
+	}
+}
+
+func (c *rxnavCaches) stats() map[string]*CacheStats {
+	return map[string]*CacheStats{
+		cacheKindRXCUI:        c.rxcui.snapshot(),
+		cacheKindInteractions: c.interactions.snapshot(),
+	}
+}
+
+// pgCacheBackend keeps cache entries in the rxnav_cache table (migrations/0007_rxnav_cache.sql) so
+// they survive restarts and are shared between instances.
+type pgCacheBackend struct {
+	pool *pgxpool.Pool
+}
+
+func (b *pgCacheBackend) Get(ctx context.Context, kind, key string) ([]byte, bool, error) {
+	var value string
+	err := b.pool.QueryRow(ctx, `
+		select value from rxnav_cache
+		where kind = $1 and key = $2 and expires_at > now()
+	`, kind, key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "does not exist") {
+			// Not cached, or table not provisioned yet; treat as a miss.
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return []byte(value), true, nil
+}
+
+func (b *pgCacheBackend) Set(ctx context.Context, kind, key string, value []byte, expiresAt time.Time) error {
+	_, err := b.pool.Exec(ctx, `
+		insert into rxnav_cache (kind, key, value, expires_at)
+		values ($1, $2, $3, $4)
+		on conflict (kind, key) do update set value = excluded.value, expires_at = excluded.expires_at
+	`, kind, key, string(value), expiresAt)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryCacheBackend stands in for the rxnav_cache table.
+type memoryCacheBackend struct {
+	mu   sync.Mutex
+	rows map[string][]byte
+}
+
+func (b *memoryCacheBackend) Get(_ context.Context, kind, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.rows[kind+"/"+key]
+	return v, ok, nil
+}
+
+func (b *memoryCacheBackend) Set(_ context.Context, kind, key string, value []byte, _ time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows[kind+"/"+key] = value
+	return nil
+}
+
+func TestLRUCacheEvictionAndTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newLRUCache[string]("test", 2, time.Minute, nil)
+	c.now = func() time.Time { return now }
+	loads := 0
+	load := func(key string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) { loads++; return "v:" + key, nil }
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		if v, err := c.get(ctx, key, load(key)); err != nil || v != "v:"+key {
+			t.Fatalf("get(%q) = %q, %v", key, v, err)
+		}
+	}
+	// a, b, c miss; a hits twice; b was evicted by c (a was more recently used) and misses again.
+	if s := c.snapshot(); loads != 4 || s.Hits != 2 || s.Misses != 4 || s.Evictions != 2 || s.Size != 2 {
+		t.Fatalf("unexpected stats after %d loads: %+v", loads, s)
+	}
+
+	now = now.Add(time.Minute)
+	if _, _ = c.get(ctx, "a", load("a")); loads != 5 || c.snapshot().Expired != 1 {
+		t.Fatalf("expected expired entry to reload, loads=%d stats=%+v", loads, c.snapshot())
+	}
+
+	failing := func(context.Context) (string, error) { loads++; return "", errors.New("rxnav_status_503") }
+	_, _ = c.get(ctx, "z", failing)
+	_, _ = c.get(ctx, "z", failing)
+	if loads != 7 {
+		t.Fatalf("errors must not be cached, loads=%d", loads)
+	}
+}
+
+func TestLRUCacheDeduplicatesConcurrentMisses(t *testing.T) {
+	c := newLRUCache[string]("test", 10, time.Minute, nil)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (string, error) {
+		loads.Add(1)
+		<-release
+		return "136411", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.get(context.Background(), "sildenafil", load); err != nil || v != "136411" {
+				t.Errorf("unexpected %q %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Fatalf("expected one upstream load, got %d", loads.Load())
+	}
+	if s := c.snapshot(); s.Shared == 0 {
+		t.Fatalf("expected shared lookups to be counted, got %+v", s)
+	}
+}
+
+func TestLRUCacheBoundsDetachedLoads(t *testing.T) {
+	c := newLRUCache[string]("test", 10, time.Minute, nil)
+	c.loadTimeout = 20 * time.Millisecond
+	hung := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.get(context.Background(), "sildenafil", hung)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the shared load to time out, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shared load was not bounded by the load timeout")
+	}
+}
+
+func TestLRUCacheBackendTier(t *testing.T) {
+	backend := &memoryCacheBackend{rows: map[string][]byte{}}
+	first := newLRUCache[[]Interaction]("interactions", 10, time.Hour, backend)
+	want := []Interaction{{Pair: "nitroglycerin + sildenafil", Severity: "HIGH"}}
+	if _, err := first.get(context.Background(), "1+2", func(context.Context) ([]Interaction, error) { return want, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second instance (or a restart) is served from the shared table.
+	second := newLRUCache[[]Interaction]("interactions", 10, time.Hour, backend)
+	got, err := second.get(context.Background(), "1+2", func(context.Context) ([]Interaction, error) {
+		t.Fatal("expected backend hit, not an upstream call")
+		return nil, nil
+	})
+	if err != nil || len(got) != 1 || got[0].Pair != want[0].Pair || second.snapshot().BackendHits != 1 {
+		t.Fatalf("unexpected backend result %+v (%v) stats %+v", got, err, second.snapshot())
+	}
+}
+
+func TestInteractionCheckCachesRxNav(t *testing.T) {
+	var calls atomic.Int32
+	rxnav := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if strings.HasSuffix(r.URL.Path, "/rxcui.json") {
+			_, _ = w.Write([]byte(`{"idGroup":{"rxnormId":["` + map[string]string{"sildenafil": "136411", "nitroglycerin": "4917"}[r.URL.Query().Get("name")] + `"]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"fullInteractionTypeGroup":[{"fullInteractionType":[{"interactionPair":[{"severity":"high","description":"Hypotension","interactionConcept":[{"minConceptItem":{"name":"sildenafil"}},{"minConceptItem":{"name":"nitroglycerin"}}]}]}]}]}`))
+	}))
+	defer rxnav.Close()
+	defer func(prev string) { rxnavBaseURL = prev }(rxnavBaseURL)
+	rxnavBaseURL = rxnav.URL
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{RxNavCacheSize: 100, RxNavCacheTTL: time.Hour})
+	for _, meds := range []string{"sildenafil, nitroglycerin", "Nitroglycerin, Sildenafil"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/interactions/check", strings.NewReader(`{"medications":"`+meds+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hypotension") {
+			t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+		}
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 2 name lookups and 1 interaction query upstream, got %d", calls.Load())
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/metrics", nil)
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"rxcui":{"size":2,"capacity":100,"hits":2,"misses":2`) {
+		t.Fatalf("unexpected metrics %s", w.Body.String())
+	}
+}
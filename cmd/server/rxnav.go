@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRxNavConcurrency   = 4
+	defaultRxNavLookupTimeout = 4 * time.Second
+	defaultRxNavRetries       = 2
+	defaultRxNavBackoff       = 250 * time.Millisecond
+)
+
+// rxnavStatusError is a non-2xx answer from RxNav.
+type rxnavStatusError struct {
+	code int
+}
+
+func (e *rxnavStatusError) Error() string {
+	return fmt.Sprintf("rxnav_status_%d", e.code)
+}
+
+// retryable reports whether err is worth another attempt: RxNav throttled the call or failed on
+// its side. Timeouts are not retried; the lookup deadline already covers every attempt.
+func retryable(err error) bool {
+	var statusErr *rxnavStatusError
+	return errors.As(err, &statusErr) && (statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500)
+}
+
+// withRetry calls call up to retries+1 times, sleeping an exponentially growing, jittered backoff
+// between retryable failures. It gives up early when ctx ends.
+func withRetry[T any](ctx context.Context, retries int, backoff time.Duration, call func(context.Context) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		v, err := call(ctx)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return v, err
+		}
+		// Equal jitter: half the step is fixed, half random, so concurrent lookups spread out.
+		step := backoff << attempt
+		wait := step/2 + rand.N(step/2+1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return v, err
+		}
+	}
+}
+
+// rxcuiLookup is the outcome of resolving one medication name.
+type rxcuiLookup struct {
+	match RxNormMatch
+	err   error
+}
+
+// resolveAll resolves meds with at most r.concurrency lookups in flight. Results keep the order
+// of meds; a failed lookup leaves an error in its slot without affecting the others.
+func (r *rxcuiResolver) resolveAll(ctx context.Context, meds []string) []rxcuiLookup {
+	out := make([]rxcuiLookup, len(meds))
+	sem := make(chan struct{}, max(r.concurrency, 1))
+	var wg sync.WaitGroup
+	for i, med := range meds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				out[i] = rxcuiLookup{match: RxNormMatch{Input: med}, err: ctx.Err()}
+				return
+			}
+			m, err := r.resolve(ctx, med)
+			out[i] = rxcuiLookup{match: m, err: err}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// lookupContext bounds one RxNav lookup, retries included.
+func (r *rxcuiResolver) lookupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// lookupWarning describes a failed lookup for the response's warnings.
+func lookupWarning(med string, err error) string {
+	reason := err.Error()
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = "timeout"
+	}
+	return fmt.Sprintf("rxcui_lookup_failed: %s (%s)", med, reason)
+}
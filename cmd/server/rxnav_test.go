@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	calls := 0
+	flaky := func(codes ...int) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) {
+			calls++
+			if calls <= len(codes) {
+				return "", &rxnavStatusError{code: codes[calls-1]}
+			}
+			return "ok", nil
+		}
+	}
+
+	if v, err := withRetry(context.Background(), 2, time.Millisecond, flaky(429, 503)); err != nil || v != "ok" || calls != 3 {
+		t.Fatalf("expected success on third attempt, got %q %v after %d calls", v, err, calls)
+	}
+	calls = 0
+	if _, err := withRetry(context.Background(), 2, time.Millisecond, flaky(400)); err == nil || calls != 1 {
+		t.Fatalf("4xx must not be retried, got %v after %d calls", err, calls)
+	}
+	calls = 0
+	if _, err := withRetry(context.Background(), 1, time.Millisecond, flaky(502, 502, 502)); err == nil || err.Error() != "rxnav_status_502" || calls != 2 {
+		t.Fatalf("expected last error after retries ran out, got %v after %d calls", err, calls)
+	}
+}
+
+func TestLookupInteractionsRxNavBoundsConcurrency(t *testing.T) {
+	var inFlight, peak, nameCalls atomic.Int32
+	rxnav := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rxcui.json") {
+			_, _ = w.Write([]byte(`{"fullInteractionTypeGroup":[]}`))
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		name := r.URL.Query().Get("name")
+		switch {
+		case name == "slowdrug":
+			time.Sleep(200 * time.Millisecond)
+		case name == "flakydrug" && nameCalls.Add(1) == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case name == "downdrug":
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(`{"idGroup":{"rxnormId":["rx-` + name + `"]}}`))
+	}))
+	defer rxnav.Close()
+	defer func(prev string) { rxnavBaseURL = prev }(rxnavBaseURL)
+	rxnavBaseURL = rxnav.URL
+
+	resolver := newRxcuiResolver(nil, false)
+	resolver.concurrency = 2
+	resolver.timeout = 50 * time.Millisecond
+	resolver.retries = 1
+	resolver.backoff = time.Millisecond
+
+	meds := []string{"sildenafil", "slowdrug", "flakydrug", "downdrug", "nitroglycerin", "tamsulosin"}
+	out := lookupInteractionsRxNav(context.Background(), resolver, meds)
+
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("expected at most 2 lookups in flight, saw %d", p)
+	}
+	if strings.Join(out.Resolved, ",") != "sildenafil,flakydrug,nitroglycerin,tamsulosin" {
+		t.Fatalf("unexpected resolved %v", out.Resolved)
+	}
+	if strings.Join(out.Unresolved, ",") != "slowdrug,downdrug" {
+		t.Fatalf("unexpected unresolved %v", out.Unresolved)
+	}
+	want := []string{"rxcui_lookup_failed: slowdrug (timeout)", "rxcui_lookup_failed: downdrug (rxnav_status_502)"}
+	if strings.Join(out.Warnings, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected warnings %q", out.Warnings)
+	}
+}
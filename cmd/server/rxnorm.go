@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	rxMatchExact      = "exact"
+	rxMatchNormalized = "normalized"
+	rxMatchFuzzy      = "fuzzy"
+	rxMatchNetwork    = "network"
+
+	// fuzzyMinSimilarity is the edit-distance similarity (1 - distance/length) a fuzzy match needs;
+	// 0.8 accepts one typo in a five-letter name and two in a ten-letter one.
+	fuzzyMinSimilarity = 0.8
+	fuzzyMinLength     = 5
+)
+
+// rxTermTypeRank orders RxNorm term types when several concepts share a name: ingredients first,
+// then brands, then everything else.
+var rxTermTypeRank = map[string]int{"IN": 0, "PIN": 1, "MIN": 2, "BN": 3}
+
+// RxNormMatch records how a medication name was resolved to an RxNorm concept.
+type RxNormMatch struct {
+	Input  string  `json:"input"`
+	RXCUI  string  `json:"rxcui"`
+	Name   string  `json:"name,omitempty"`
+	Method string  `json:"method"`
+	Score  float64 `json:"score"`
+}
+
+type rxnormConcept struct {
+	rxcui string
+	name  string
+	tty   string
+}
+
+// rxnormStore resolves medication names to RXCUIs offline from a local concept table, trying the
+// exact name, then the normalized drug name, then a fuzzy match against ingredient and brand names.
+type rxnormStore struct {
+	concepts   []rxnormConcept
+	exact      map[string]int
+	normalized map[string]int
+	trigrams   map[string][]int
+}
+
+func newRxNormStore() *rxnormStore {
+	return &rxnormStore{exact: map[string]int{}, normalized: map[string]int{}, trigrams: map[string][]int{}}
+}
+
+// loadRxNormConcepts reads RXNCONSO.RRF (by its .rrf extension) or a CSV export with rxcui and name
+// columns and an optional tty column.
+func loadRxNormConcepts(path string) (*rxnormStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store := newRxNormStore()
+	if strings.EqualFold(filepath.Ext(path), ".rrf") {
+		err = store.readRRF(f)
+	} else {
+		err = store.readCSV(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(store.concepts) == 0 {
+		return nil, errors.New("no concepts loaded")
+	}
+	return store, nil
+}
+
+// readRRF loads English, unsuppressed RXNORM-sourced atoms from RXNCONSO.RRF.
+func (s *rxnormStore) readRRF(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 17 {
+			return fmt.Errorf("line %d: expected RXNCONSO.RRF columns, got %d fields", line, len(fields))
+		}
+		// RXCUI|LAT|TS|LUI|STT|SUI|ISPREF|RXAUI|SAUI|SCUI|SDUI|SAB|TTY|CODE|STR|SRL|SUPPRESS|CVF
+		if fields[1] != "ENG" || fields[11] != "RXNORM" || (fields[16] != "N" && fields[16] != "") {
+			continue
+		}
+		s.add(rxnormConcept{rxcui: fields[0], name: fields[14], tty: fields[12]})
+	}
+	return scanner.Err()
+}
+
+func (s *rxnormStore) readCSV(in io.Reader) error {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	rxcuiCol, ok := cols["rxcui"]
+	nameCol, ok2 := cols["name"]
+	if !ok2 {
+		nameCol, ok2 = cols["str"]
+	}
+	if !ok || !ok2 {
+		return errors.New("expected rxcui and name columns")
+	}
+	ttyCol, hasTTY := cols["tty"]
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rxcuiCol >= len(row) || nameCol >= len(row) {
+			continue
+		}
+		c := rxnormConcept{rxcui: strings.TrimSpace(row[rxcuiCol]), name: strings.TrimSpace(row[nameCol])}
+		if hasTTY && ttyCol < len(row) {
+			c.tty = strings.ToUpper(strings.TrimSpace(row[ttyCol]))
+		}
+		if c.rxcui != "" && c.name != "" {
+			s.add(c)
+		}
+	}
+}
+
+func (s *rxnormStore) add(c rxnormConcept) {
+	idx := len(s.concepts)
+	s.concepts = append(s.concepts, c)
+	s.index(s.exact, strings.ToLower(strings.TrimSpace(c.name)), idx)
+	norm := normalizeDrugName(c.name)
+	s.index(s.normalized, norm, idx)
+
+	if _, ingredientOrBrand := rxTermTypeRank[c.tty]; ingredientOrBrand || c.tty == "" {
+		seen := map[string]bool{}
+		for _, t := range trigrams(norm) {
+			if !seen[t] {
+				seen[t] = true
+				s.trigrams[t] = append(s.trigrams[t], idx)
+			}
+		}
+	}
+}
+
+// index maps key to idx unless an existing concept with that name has a preferred term type.
+func (s *rxnormStore) index(m map[string]int, key string, idx int) {
+	if key == "" {
+		return
+	}
+	if prev, ok := m[key]; ok && termRank(s.concepts[prev].tty) <= termRank(s.concepts[idx].tty) {
+		return
+	}
+	m[key] = idx
+}
+
+// preferred breaks ties between equally similar concepts: better term type, then load order.
+func (s *rxnormStore) preferred(idx, than int) bool {
+	a, b := termRank(s.concepts[idx].tty), termRank(s.concepts[than].tty)
+	return a < b || (a == b && idx < than)
+}
+
+func termRank(tty string) int {
+	if rank, ok := rxTermTypeRank[tty]; ok {
+		return rank
+	}
+	return len(rxTermTypeRank)
+}
+
+// match resolves a free-text medication entry ("Viagra 50mg PO", "sildenafill") to a concept.
+func (s *rxnormStore) match(med string) (RxNormMatch, bool) {
+	if s == nil {
+		return RxNormMatch{}, false
+	}
+	found := func(idx int, method string, score float64) (RxNormMatch, bool) {
+		c := s.concepts[idx]
+		return RxNormMatch{Input: med, RXCUI: c.rxcui, Name: c.name, Method: method, Score: score}, true
+	}
+	if idx, ok := s.exact[strings.ToLower(strings.TrimSpace(med))]; ok {
+		return found(idx, rxMatchExact, 1)
+	}
+
+	// Strip dose, route and frequency, then try the name and the generic the drug-class registry
+	// maps it to (so "GTN" finds nitroglycerin).
+	sig, ok := parseMedicationSig(med)
+	if !ok {
+		return RxNormMatch{}, false
+	}
+	name := normalizeDrugName(sig.Name)
+	for _, key := range []string{name, normalizeDrugName(sig.Generic)} {
+		if idx, ok := s.normalized[key]; ok && key != "" {
+			return found(idx, rxMatchNormalized, 1)
+		}
+	}
+
+	if idx, score := s.fuzzy(name); idx >= 0 {
+		return found(idx, rxMatchFuzzy, score)
+	}
+	return RxNormMatch{}, false
+}
+
+// fuzzy returns the ingredient or brand concept most similar to name, or -1. Candidates must share
+// at least a third of name's trigrams before edit distance is computed.
+func (s *rxnormStore) fuzzy(name string) (int, float64) {
+	if len([]rune(name)) < fuzzyMinLength {
+		return -1, 0
+	}
+	grams := trigrams(name)
+	shared := map[int]int{}
+	for _, t := range grams {
+		for _, idx := range s.trigrams[t] {
+			shared[idx]++
+		}
+	}
+	best, bestScore := -1, 0.0
+	for idx, n := range shared {
+		if n*3 < len(grams) {
+			continue
+		}
+		score := similarity(name, normalizeDrugName(s.concepts[idx].name))
+		if score < fuzzyMinSimilarity || score < bestScore {
+			continue
+		}
+		if score > bestScore || s.preferred(idx, best) {
+			best, bestScore = idx, score
+		}
+	}
+	return best, bestScore
+}
+
+// normalizeDrugName lowercases name, turns punctuation into spaces and collapses whitespace.
+func normalizeDrugName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func trigrams(s string) []string {
+	runes := []rune(" " + s + " ")
+	var out []string
+	for i := 0; i+3 <= len(runes); i++ {
+		out = append(out, string(runes[i:i+3]))
+	}
+	return out
+}
+
+// similarity is 1 - levenshtein(a, b) / max(len(a), len(b)).
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// rxcuiResolver resolves names against the local concept store first and, when network is set,
+// falls back to RxNav. RxNav answers go through cache; each RxNav lookup gets its own timeout and
+// up to retries further attempts on 429 and 5xx answers.
+type rxcuiResolver struct {
+	local       *rxnormStore
+	network     bool
+	cache       *rxnavCaches
+	concurrency int
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+}
+
+// newRxcuiResolver uses the network when no local store is configured, or when fallback is enabled.
+func newRxcuiResolver(local *rxnormStore, fallback bool) *rxcuiResolver {
+	return &rxcuiResolver{
+		local:       local,
+		network:     local == nil || fallback,
+		cache:       &rxnavCaches{},
+		concurrency: defaultRxNavConcurrency,
+		timeout:     defaultRxNavLookupTimeout,
+		retries:     defaultRxNavRetries,
+		backoff:     defaultRxNavBackoff,
+	}
+}
+
+// resolve returns the match for med; an empty RXCUI with a nil error means no concept was found.
+func (r *rxcuiResolver) resolve(ctx context.Context, med string) (RxNormMatch, error) {
+	if m, ok := r.local.match(med); ok {
+		return m, nil
+	}
+	if !r.network {
+		return RxNormMatch{Input: med}, nil
+	}
+	ctx, cancel := r.lookupContext(ctx)
+	defer cancel()
+	rxcui, err := r.cache.rxcui.get(ctx, strings.ToLower(strings.TrimSpace(med)), func(ctx context.Context) (string, error) {
+		// The cache detaches shared loads from the caller, so the deadline is applied again here.
+		ctx, cancel := r.lookupContext(ctx)
+		defer cancel()
+		return withRetry(ctx, r.retries, r.backoff, func(ctx context.Context) (string, error) {
+			return resolveRXCUI(ctx, med)
+		})
+	})
+	if err != nil || rxcui == "" {
+		return RxNormMatch{Input: med}, err
+	}
+	return RxNormMatch{Input: med, RXCUI: rxcui, Method: rxMatchNetwork, Score: 1}, nil
+}
+
+// interactions fetches the RxNav interaction list for a set of RXCUIs, in any order.
+func (r *rxcuiResolver) interactions(ctx context.Context, rxcuis []string) ([]Interaction, error) {
+	sorted := append([]string(nil), rxcuis...)
+	sort.Strings(sorted)
+	ctx, cancel := r.lookupContext(ctx)
+	defer cancel()
+	return r.cache.interactions.get(ctx, strings.Join(sorted, "+"), func(ctx context.Context) ([]Interaction, error) {
+		ctx, cancel := r.lookupContext(ctx)
+		defer cancel()
+		return withRetry(ctx, r.retries, r.backoff, func(ctx context.Context) ([]Interaction, error) {
+			return fetchRxNavInteractions(ctx, sorted)
+		})
+	})
+}
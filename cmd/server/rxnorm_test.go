@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeConcepts(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testRxNormStore(t *testing.T) *rxnormStore {
+	t.Helper()
+	store, err := loadRxNormConcepts(writeConcepts(t, "concepts.csv", `rxcui,name,tty
+136411,sildenafil,IN
+190465,Viagra,BN
+358263,tadalafil,IN
+4917,nitroglycerin,IN
+312950,sildenafil 20 MG Oral Tablet,SCD
+`))
+	if err != nil {
+		t.Fatalf("load concepts: %v", err)
+	}
+	return store
+}
+
+func TestRxNormStoreMatching(t *testing.T) {
+	store := testRxNormStore(t)
+	for med, want := range map[string]RxNormMatch{
+		"Viagra":                       {RXCUI: "190465", Method: rxMatchExact},
+		"sildenafil 20 mg oral tablet": {RXCUI: "312950", Method: rxMatchExact},
+		"Tadalafil 5mg PO daily":       {RXCUI: "358263", Method: rxMatchNormalized},
+		"GTN 400mcg SL":                {RXCUI: "4917", Method: rxMatchNormalized},
+		"tadalafyl":                    {RXCUI: "358263", Method: rxMatchFuzzy},
+		"Sildenafeel 50mg":             {RXCUI: "136411", Method: rxMatchFuzzy},
+	} {
+		got, ok := store.match(med)
+		if !ok || got.RXCUI != want.RXCUI || got.Method != want.Method {
+			t.Errorf("match(%q) = %+v, want rxcui %s via %s", med, got, want.RXCUI, want.Method)
+		}
+	}
+	for _, med := range []string{"vitamin d", "tada", "metformin 500mg"} {
+		if got, ok := store.match(med); ok {
+			t.Errorf("match(%q) = %+v, want no match", med, got)
+		}
+	}
+}
+
+func TestLoadRxNormRRF(t *testing.T) {
+	rrf := strings.Join([]string{
+		"136411|ENG||||||1||||RXNORM|IN|136411|sildenafil||N||",
+		"136411|ENG||||||2||||MTHSPL|SU|X|SILDENAFIL CITRATE||N||",
+		"999999|ENG||||||3||||RXNORM|IN|999999|withdrawnium||O||",
+		"136411|SPA||||||4||||RXNORM|IN|136411|sildenafilo||N||",
+	}, "\n") + "\n"
+	store, err := loadRxNormConcepts(writeConcepts(t, "RXNCONSO.RRF", rrf))
+	if err != nil {
+		t.Fatalf("load rrf: %v", err)
+	}
+	if len(store.concepts) != 1 || store.concepts[0].name != "sildenafil" {
+		t.Fatalf("expected only the English RXNORM unsuppressed atom, got %+v", store.concepts)
+	}
+	if _, err := loadRxNormConcepts(writeConcepts(t, "bad.csv", "id,label\n1,x\n")); err == nil {
+		t.Fatal("expected error for CSV without rxcui/name columns")
+	}
+}
+
+func TestInteractionCheckOfflineResolution(t *testing.T) {
+	calls := 0
+	rxnav := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_ = json.NewEncoder(w).Encode(map[string]any{"idGroup": map[string]any{"rxnormId": []string{"6809"}}})
+	}))
+	defer rxnav.Close()
+	defer func(prev string) { rxnavBaseURL = prev }(rxnavBaseURL)
+	rxnavBaseURL = rxnav.URL
+
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{RxNorm: testRxNormStore(t)})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/interactions/check", strings.NewReader(`{"medications":"Viagra 50mg, nitroglycerin SL, metformin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var resp InteractionCheckResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if calls != 0 {
+		t.Fatalf("expected no RxNav calls without RXNAV_FALLBACK, got %d", calls)
+	}
+	if len(resp.Matches) != 2 || resp.Matches[0].RXCUI != "190465" || len(resp.Unresolved) != 1 || resp.Unresolved[0] != "metformin" {
+		t.Fatalf("unexpected resolution %+v", resp)
+	}
+	if !containsString(resp.Warnings, "rxnav_offline: interaction list not fetched") {
+		t.Fatalf("expected offline warning, got %v", resp.Warnings)
+	}
+
+	// With fallback enabled, names missing from the local store go to RxNav.
+	resolver := newRxcuiResolver(testRxNormStore(t), true)
+	match, err := resolver.resolve(context.Background(), "metformin")
+	if err != nil || match.RXCUI != "6809" || match.Method != rxMatchNetwork || calls != 1 {
+		t.Fatalf("expected network fallback, got %+v (%v), calls=%d", match, err, calls)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// contentSecurityPolicy matches the bundled frontend: scripts and styles from this origin, Google
+// Fonts, data: URIs used by styles.css, and inline handlers and style attributes in index.html.
+// API calls may also go to the separate backend origins listed in CSP_CONNECT_SRC.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline'; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+	"font-src 'self' https://fonts.gstatic.com; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'%s; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'"
+
+const hstsPolicy = "max-age=31536000; includeSubDomains"
+
+// corsMiddleware allows cross-origin calls only from the configured origins. An empty list leaves
+// the API same-origin only; "*" allows any origin but never with credentials.
+func corsMiddleware(cfg *Config) gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOriginFunc:  func(origin string) bool { return originAllowed(cfg.CORSAllowedOrigins, origin) },
+		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", apiKeyHeader},
+		ExposeHeaders:    []string{"Retry-After"},
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           12 * time.Hour,
+	})
+}
+
+// originAllowed matches origin against the allow-list. "https://*.example.com" matches any
+// subdomain of example.com over https, but not example.com itself.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	for _, pattern := range allowed {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		prefix, suffix, wildcard := strings.Cut(pattern, "*.")
+		if wildcard && strings.HasPrefix(origin, prefix) {
+			host := strings.TrimPrefix(origin, prefix)
+			if strings.HasSuffix(host, "."+suffix) && !strings.ContainsAny(host, "/@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseOriginList parses CORS_ALLOWED_ORIGINS: comma-separated scheme://host[:port] origins, with
+// an optional "*." in front of the host, or "*" alone.
+func parseOriginList(raw string) ([]string, error) {
+	var out []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.ToLower(strings.TrimRight(strings.TrimSpace(entry), "/"))
+		if entry == "" {
+			continue
+		}
+		if entry != "*" {
+			u, err := url.Parse(strings.Replace(entry, "://*.", "://wildcard.", 1))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+				return nil, fmt.Errorf("expected scheme://host[:port], got %q", entry)
+			}
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// securityHeaders sets the browser hardening headers on every response. HSTS is only sent over
+// HTTPS, including behind a TLS-terminating proxy.
+func securityHeaders(connectSrc []string) gin.HandlerFunc {
+	extra := ""
+	if len(connectSrc) > 0 {
+		extra = " " + strings.Join(connectSrc, " ")
+	}
+	csp := fmt.Sprintf(contentSecurityPolicy, extra)
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Content-Security-Policy", csp)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+			h.Set("Strict-Transport-Security", hstsPolicy)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseOriginList(t *testing.T) {
+	origins, err := parseOriginList(" https://App.example.com/, https://*.clinic.org:8443 ,")
+	if err != nil || len(origins) != 2 || origins[0] != "https://app.example.com" || origins[1] != "https://*.clinic.org:8443" {
+		t.Fatalf("unexpected origins %v (%v)", origins, err)
+	}
+	for _, bad := range []string{"example.com", "ftp://example.com", "https://example.com/app", "https://user@example.com"} {
+		if _, err := parseOriginList(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.clinic.org"}
+	for origin, want := range map[string]bool{
+		"https://app.example.com":    true,
+		"https://a.clinic.org":       true,
+		"https://x.y.clinic.org":     true,
+		"https://clinic.org":         false,
+		"https://evilclinic.org":     false,
+		"http://a.clinic.org":        false,
+		"https://a.clinic.org.evil":  false,
+		"https://other.example.com":  false,
+		"https://app.example.com:81": false,
+	} {
+		if got := originAllowed(allowed, origin); got != want {
+			t.Errorf("originAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSAllowList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, ".", &Config{
+		CORSAllowedOrigins:   []string{"https://*.clinic.org"},
+		CORSAllowCredentials: true,
+	})
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", "/api/diagnostics/mock", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := preflight("https://portal.clinic.org")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://portal.clinic.org" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected allowed preflight with credentials, got %d %v", w.Code, w.Header())
+	}
+	if w := preflight("https://evil.example"); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected disallowed origin to be rejected, got %d %v", w.Code, w.Header())
+	}
+
+	// Without an allow-list only same-origin requests are served.
+	router = setupRouter(nil, nil, ".", &Config{})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/config", nil)
+	req.Header.Set("Origin", "https://portal.clinic.org")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected cross-origin request to be rejected by default, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/config", nil)
+	req.Host = "gorocky.example"
+	req.Header.Set("Origin", "https://gorocky.example")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected same-origin request to pass, got %d", w.Code)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, nil, "../..", &Config{CSPConnectSrc: []string{"https://api.example.com"}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected index.html, got %d", w.Code)
+	}
+	csp := w.Header().Get("Content-Security-Policy")
+	for _, directive := range []string{"frame-ancestors 'none'", "connect-src 'self' https://api.example.com;", "https://fonts.googleapis.com", "https://fonts.gstatic.com", "img-src 'self' data:"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("CSP %q missing %q", csp, directive)
+		}
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("missing hardening headers: %v", w.Header())
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatal("HSTS must not be sent over plain HTTP")
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Strict-Transport-Security") != hstsPolicy {
+		t.Fatalf("expected HSTS behind a TLS proxy, got %v", w.Header())
+	}
+}
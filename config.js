@@ -6,6 +6,9 @@
 window.__APP_CONFIG = window.__APP_CONFIG || {
     apiBaseUrl: 'https://gocare-backend.onrender.com',
     defaultModel: 'openai', // options: mock | gemini | openai
+    // Bearer credential sent when the API requires auth (API key or OIDC access token).
+    // Prefer setting sessionStorage['gorocky.authToken'] at login over hard-coding it here.
+    authToken: '',
     models: {
         mock: true,
         gemini: true,
@@ -0,0 +1,62 @@
+// Package drugclasses reads the drug-class registry file shared by the server, which resolves
+// medication names to classes, and the interaction importer, which checks "class:" rows against it.
+package drugclasses
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed drug_classes.yaml
+var defaultYAML []byte
+
+// Class lists a class's member generics, each with the brand names, abbreviations and
+// misspellings that resolve to it.
+type Class struct {
+	Label   string              `json:"label" yaml:"label"`
+	Members map[string][]string `json:"members" yaml:"members"`
+}
+
+// File is the registry file: classes by name and combination products by name.
+type File struct {
+	Classes      map[string]Class    `yaml:"classes"`
+	Combinations map[string][]string `yaml:"combinations"`
+}
+
+// Load reads a registry file. An empty path yields the bundled default registry.
+func Load(path string) (*File, error) {
+	raw := defaultYAML
+	if path != "" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read drug classes: %w", err)
+		}
+	}
+
+	var file File
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("decode drug classes: %w", err)
+	}
+	if len(file.Classes) == 0 {
+		return nil, fmt.Errorf("drug classes: no classes defined")
+	}
+	return &file, nil
+}
+
+// Has reports whether the file defines className, ignoring case.
+func (f *File) Has(className string) bool {
+	for name := range f.Classes {
+		if strings.EqualFold(name, className) {
+			return true
+		}
+	}
+	return false
+}
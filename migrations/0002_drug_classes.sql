@@ -0,0 +1,10 @@
+-- Drug-class registry extensions. Rows are merged on top of the bundled
+-- internal/drugclasses/drug_classes.yaml at startup; an empty synonym registers
+-- the generic itself as a class member.
+CREATE TABLE IF NOT EXISTS drug_class_members (
+    class_name TEXT NOT NULL,
+    generic    TEXT NOT NULL,
+    synonym    TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (class_name, generic, synonym)
+);
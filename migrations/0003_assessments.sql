@@ -0,0 +1,29 @@
+-- Immutable record of every diagnostic run: the submitted payload, the
+-- DiagnosticResult returned, the engine that produced it and the rule pack
+-- version in force. Rows are append-only; updates and deletes are rejected.
+CREATE TABLE IF NOT EXISTS assessments (
+    id                UUID PRIMARY KEY,
+    endpoint          TEXT NOT NULL,
+    provider          TEXT NOT NULL,
+    rule_pack_version TEXT NOT NULL DEFAULT '',
+    rule_pack_hash    TEXT NOT NULL DEFAULT '',
+    risk_level        TEXT NOT NULL DEFAULT '',
+    risk_score        INTEGER NOT NULL DEFAULT 0,
+    request           JSONB NOT NULL,
+    result            JSONB NOT NULL,
+    requested_at      TIMESTAMPTZ NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS assessments_created_at_idx ON assessments (created_at DESC, id);
+
+CREATE OR REPLACE FUNCTION assessments_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'assessments are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS assessments_immutable ON assessments;
+CREATE TRIGGER assessments_immutable
+    BEFORE UPDATE OR DELETE ON assessments
+    FOR EACH ROW EXECUTE FUNCTION assessments_immutable();
@@ -0,0 +1,27 @@
+-- Clinician reviews of an assessment. Each row stores the amended plan, the
+-- before/after diff against the plan in effect, and the justification given
+-- when a HIGH safety blocker was overridden. Rows are append-only.
+CREATE TABLE IF NOT EXISTS assessment_reviews (
+    id                UUID PRIMARY KEY,
+    assessment_id     UUID NOT NULL REFERENCES assessments (id),
+    reviewer          TEXT NOT NULL,
+    plan              JSONB NOT NULL,
+    confidence        DOUBLE PRECISION,
+    justification     TEXT NOT NULL DEFAULT '',
+    overrides_blocker BOOLEAN NOT NULL DEFAULT FALSE,
+    diff              JSONB NOT NULL DEFAULT '[]',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS assessment_reviews_assessment_idx ON assessment_reviews (assessment_id, created_at);
+
+CREATE OR REPLACE FUNCTION assessment_reviews_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'assessment reviews are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS assessment_reviews_immutable ON assessment_reviews;
+CREATE TRIGGER assessment_reviews_immutable
+    BEFORE UPDATE OR DELETE ON assessment_reviews
+    FOR EACH ROW EXECUTE FUNCTION assessment_reviews_immutable();
@@ -0,0 +1,24 @@
+-- Local drug-drug interaction knowledge base queried by POST /api/interactions/check
+-- before falling back to RxNav. Loaded with `go run ./cmd/import` (the bundled seed
+-- covers every class in the default rule pack).
+--
+-- Pairs are stored once, lowercase, with drug_a < drug_b so a lookup never has to
+-- try both orders. A pair may appear once per source dataset; re-importing the same
+-- source updates rows in place.
+CREATE TABLE IF NOT EXISTS drug_interactions (
+    id             BIGSERIAL PRIMARY KEY,
+    drug_a         TEXT NOT NULL,
+    drug_b         TEXT NOT NULL,
+    severity       TEXT NOT NULL CHECK (severity IN ('HIGH', 'MEDIUM', 'LOW')),
+    note           TEXT NOT NULL DEFAULT '',
+    source         TEXT NOT NULL,
+    evidence_level TEXT NOT NULL DEFAULT '',
+    -- Citations (label sections, DOIs, URLs) backing the row.
+    refs           TEXT[] NOT NULL DEFAULT '{}',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (drug_a = lower(drug_a) AND drug_b = lower(drug_b) AND drug_a < drug_b),
+    UNIQUE (drug_a, drug_b, source)
+);
+
+CREATE INDEX IF NOT EXISTS drug_interactions_drug_b_idx ON drug_interactions (drug_b);
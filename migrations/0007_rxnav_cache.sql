@@ -0,0 +1,13 @@
+-- Shared second tier for the RxNav lookup cache (RXNAV_CACHE_DB=true). Rows hold
+-- the JSON-encoded answer for one name resolution (kind 'rxcui') or one
+-- interaction-list query (kind 'interactions'); expired rows are ignored and
+-- overwritten on the next lookup.
+CREATE TABLE IF NOT EXISTS rxnav_cache (
+    kind       TEXT NOT NULL,
+    key        TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE INDEX IF NOT EXISTS rxnav_cache_expires_at_idx ON rxnav_cache (expires_at);
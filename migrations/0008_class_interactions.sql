@@ -0,0 +1,19 @@
+-- Class-level interaction rows. Either side of a drug_interactions row may name a
+-- drug class ("nitrates" <-> "pde5i") instead of a drug. A class side covers every
+-- member in the drug-class registry (internal/drugclasses/drug_classes.yaml plus the
+-- drug_class_members table), so new members inherit the class's interactions.
+--
+-- Sides are ordered by (kind, name), so class sides come first; names stay lowercase.
+ALTER TABLE drug_interactions
+    ADD COLUMN IF NOT EXISTS kind_a TEXT NOT NULL DEFAULT 'drug' CHECK (kind_a IN ('drug', 'class')),
+    ADD COLUMN IF NOT EXISTS kind_b TEXT NOT NULL DEFAULT 'drug' CHECK (kind_b IN ('drug', 'class'));
+
+ALTER TABLE drug_interactions DROP CONSTRAINT IF EXISTS drug_interactions_check;
+ALTER TABLE drug_interactions DROP CONSTRAINT IF EXISTS drug_interactions_canonical_check;
+ALTER TABLE drug_interactions ADD CONSTRAINT drug_interactions_canonical_check
+    CHECK (drug_a = lower(drug_a) AND drug_b = lower(drug_b) AND (kind_a, drug_a) < (kind_b, drug_b));
+
+ALTER TABLE drug_interactions DROP CONSTRAINT IF EXISTS drug_interactions_drug_a_drug_b_source_key;
+ALTER TABLE drug_interactions DROP CONSTRAINT IF EXISTS drug_interactions_pair_source_key;
+ALTER TABLE drug_interactions ADD CONSTRAINT drug_interactions_pair_source_key
+    UNIQUE (kind_a, drug_a, kind_b, drug_b, source);